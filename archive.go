@@ -0,0 +1,171 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultMaxArchiveEntries is used when MaxArchiveEntries is not set
+const defaultMaxArchiveEntries = 10000
+
+// zipMagic starts every zip archive that has entries
+var zipMagic = []byte("PK\x03\x04")
+
+// Unzip() extracts the zip archive at archivePath into destDir and returns the paths of the
+// extracted files. Entries may not leave destDir and links are rejected. The total size is capped at
+// MaxDecompressedSize and the number of entries at MaxArchiveEntries. Zip archives found inside the
+// archive are kept as files, unless MaxArchiveDepth is set: then they are extracted into a directory
+// named after them, and archives nested deeper than MaxArchiveDepth are rejected.
+// Files extracted before an error are removed again
+func (t *Tools) Unzip(archivePath, destDir string) ([]string, error) {
+	maxSize := t.MaxDecompressedSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxDecompressedSize
+	}
+	maxEntries := t.MaxArchiveEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxArchiveEntries
+	}
+
+	destDir = filepath.Clean(destDir)
+	if err := t.CreateNewDirectory(destDir); err != nil {
+		return nil, err
+	}
+
+	u := &unzipper{maxDepth: t.MaxArchiveDepth, maxEntries: maxEntries, maxSize: int64(maxSize)}
+	if err := u.extract(archivePath, destDir, 0); err != nil {
+		for _, file := range u.files {
+			os.Remove(file)
+		}
+		return nil, err
+	}
+
+	return u.files, nil
+}
+
+// unzipper keeps the totals of an extraction across nested archives
+type unzipper struct {
+	maxDepth   int
+	maxEntries int
+	maxSize    int64
+	entries    int
+	written    int64
+	files      []string
+}
+
+// extract extracts one archive, depth is the number of archives it is nested in
+func (u *unzipper) extract(archivePath, destDir string, depth int) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("cannot open the archive %s: %w", filepath.Base(archivePath), err)
+	}
+	defer zr.Close()
+
+	for _, entry := range zr.File {
+		u.entries++
+		if u.entries > u.maxEntries {
+			return fmt.Errorf("the archive has more than %d entries", u.maxEntries)
+		}
+
+		// Never write outside of the destination directory
+		target := filepath.Join(destDir, entry.Name)
+		if rel, err := filepath.Rel(destDir, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("the archive entry %q resolves outside of the destination", entry.Name)
+		}
+
+		mode := entry.Mode()
+		if mode.IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !mode.IsRegular() {
+			return fmt.Errorf("the archive entry %q is not a regular file", entry.Name)
+		}
+
+		isArchive, err := u.writeEntry(entry, target)
+		if err != nil {
+			return err
+		}
+		if !isArchive || u.maxDepth == 0 {
+			continue
+		}
+
+		// Replace a nested archive by its contents, as long as it is not nested too deeply
+		if depth+1 > u.maxDepth {
+			return fmt.Errorf("the archive entry %q nests archives deeper than %d levels", entry.Name, u.maxDepth)
+		}
+		nestedDir := strings.TrimSuffix(target, filepath.Ext(target))
+		if nestedDir == target {
+			nestedDir += "_contents"
+		}
+		if err := u.extract(target, nestedDir, depth+1); err != nil {
+			return err
+		}
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+		u.files = removeString(u.files, target)
+	}
+
+	return nil
+}
+
+// writeEntry writes a file of the archive to disk, reporting whether it is a zip archive itself
+func (u *unzipper) writeEntry(entry *zip.File, target string) (bool, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return false, err
+	}
+
+	rc, err := entry.Open()
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	// Existing files, including duplicate entries, are never overwritten
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return false, fmt.Errorf("the archive entry %q already exists", entry.Name)
+		}
+		return false, err
+	}
+	defer out.Close()
+	u.files = append(u.files, target)
+
+	// Check the magic number before the content is copied
+	content := bufio.NewReader(rc)
+	magic, _ := content.Peek(len(zipMagic))
+
+	// Copy one byte past the remaining budget to detect decompression bombs
+	n, err := io.Copy(out, io.LimitReader(content, u.maxSize-u.written+1))
+	u.written += n
+	if err != nil {
+		return false, fmt.Errorf("cannot extract the archive entry %q: %w", entry.Name, err)
+	}
+	if u.written > u.maxSize {
+		return false, fmt.Errorf("the archive decompresses to more than %d bytes", u.maxSize)
+	}
+
+	return bytes.Equal(magic, zipMagic), nil
+}
+
+// removeString returns the slice without the given value
+func removeString(values []string, value string) []string {
+	kept := values[:0]
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,143 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// zipEntry is a file written into a test archive
+type zipEntry struct {
+	name    string
+	content []byte
+}
+
+// zipBytes builds a zip archive of the entries in memory
+func zipBytes(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write(e.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// nestedZip wraps the content in the given number of archives
+func nestedZip(t *testing.T, levels int, content []byte) []byte {
+	data := zipBytes(t, zipEntry{"payload.txt", content})
+	for i := 1; i < levels; i++ {
+		data = zipBytes(t, zipEntry{fmt.Sprintf("level%d.zip", i), data})
+	}
+	return data
+}
+
+func TestTools_Unzip(t *testing.T) {
+	var many []zipEntry
+	for i := 0; i < 50; i++ {
+		many = append(many, zipEntry{fmt.Sprintf("file%d.txt", i), []byte("x")})
+	}
+
+	tests := []struct {
+		name          string
+		archive       func(t *testing.T) []byte
+		tools         Tools
+		expected      []string
+		errorExpected string
+	}{
+		{
+			name: "Plain archive",
+			archive: func(t *testing.T) []byte {
+				return zipBytes(t, zipEntry{"a.txt", []byte("a")}, zipEntry{"docs/b.txt", []byte("b")})
+			},
+			expected: []string{"a.txt", "docs/b.txt"},
+		},
+		{
+			name:     "Nested archive kept by default",
+			archive:  func(t *testing.T) []byte { return nestedZip(t, 2, []byte("deep")) },
+			expected: []string{"level1.zip"},
+		},
+		{
+			name:     "Nested archive within the depth",
+			archive:  func(t *testing.T) []byte { return nestedZip(t, 2, []byte("deep")) },
+			tools:    Tools{MaxArchiveDepth: 1},
+			expected: []string{"level1/payload.txt"},
+		},
+		{
+			name:          "Nested archive bomb",
+			archive:       func(t *testing.T) []byte { return nestedZip(t, 5, []byte("deep")) },
+			tools:         Tools{MaxArchiveDepth: 2},
+			errorExpected: `the archive entry "level2.zip" nests archives deeper than 2 levels`,
+		},
+		{
+			name:          "Too many entries",
+			archive:       func(t *testing.T) []byte { return zipBytes(t, many...) },
+			tools:         Tools{MaxArchiveEntries: 10},
+			errorExpected: "the archive has more than 10 entries",
+		},
+		{
+			name:          "Too large once extracted",
+			archive:       func(t *testing.T) []byte { return zipBytes(t, zipEntry{"zeros.bin", make([]byte, 1<<20)}) },
+			tools:         Tools{MaxDecompressedSize: 1024},
+			errorExpected: "the archive decompresses to more than 1024 bytes",
+		},
+		{
+			name:          "Entry outside the destination",
+			archive:       func(t *testing.T) []byte { return zipBytes(t, zipEntry{"../evil.txt", []byte("x")}) },
+			errorExpected: `the archive entry "../evil.txt" resolves outside of the destination`,
+		},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			dir := t.TempDir()
+			archivePath := filepath.Join(dir, "archive.zip")
+			if err := os.WriteFile(archivePath, entry.archive(t), 0644); err != nil {
+				t.Fatal(err)
+			}
+			destDir := filepath.Join(dir, "out")
+
+			files, err := entry.tools.Unzip(archivePath, destDir)
+			if entry.errorExpected != "" {
+				if err == nil || err.Error() != entry.errorExpected {
+					t.Fatalf("expected error %q, but received %v", entry.errorExpected, err)
+				}
+				// Nothing extracted is left behind
+				if count, _ := entry.tools.CountFiles(destDir, "", true); count != 0 {
+					t.Errorf("expected no files left, but received %d", count)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			var names []string
+			for _, f := range files {
+				rel, _ := filepath.Rel(destDir, f)
+				names = append(names, filepath.ToSlash(rel))
+			}
+			sort.Strings(names)
+			if strings.Join(names, ",") != strings.Join(entry.expected, ",") {
+				t.Errorf("expected files %v, but received %v", entry.expected, names)
+			}
+			if count, _ := entry.tools.CountFiles(destDir, "", true); count != len(entry.expected) {
+				t.Errorf("expected %d files on disk, but received %d", len(entry.expected), count)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package toolkit
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Names of the charsets recognized by detectCharset
+const (
+	charsetUTF8    = "utf-8"
+	charsetUTF16LE = "utf-16le"
+	charsetUTF16BE = "utf-16be"
+	charsetLatin1  = "iso-8859-1"
+)
+
+// isTextType reports whether the detected content type is text
+func isTextType(fileType string) bool {
+	return strings.HasPrefix(fileType, "text/")
+}
+
+// detectCharset guesses the charset of a text file. UTF-16 is recognized by its byte order mark,
+// valid UTF-8 is reported as such, and anything else is assumed to be Latin-1.
+// The whole file is read in chunks, the caller has to seek back afterwards
+func detectCharset(r io.ReadSeeker) (string, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 32*1024)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	switch {
+	case bytes.HasPrefix(buf[:n], []byte{0xFF, 0xFE}):
+		return charsetUTF16LE, nil
+	case bytes.HasPrefix(buf[:n], []byte{0xFE, 0xFF}):
+		return charsetUTF16BE, nil
+	}
+
+	// Check the file chunk by chunk, carrying a rune split between chunks over to the next one
+	pending := buf[:n]
+	for {
+		valid := len(pending)
+		// Leave out up to three trailing bytes of an incomplete rune
+		for i := 1; i <= 3 && i <= len(pending); i++ {
+			if utf8.RuneStart(pending[len(pending)-i]) {
+				if !utf8.FullRune(pending[len(pending)-i:]) {
+					valid = len(pending) - i
+				}
+				break
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			valid = len(pending)
+		}
+
+		if !utf8.Valid(pending[:valid]) {
+			return charsetLatin1, nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return charsetUTF8, nil
+		}
+
+		// Move the incomplete rune to the front of the buffer and read the next chunk
+		carried := copy(buf, pending[valid:])
+		n, err = io.ReadFull(r, buf[carried:])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return "", err
+		}
+		pending = buf[:carried+n]
+	}
+}
+
+// charsetDecoder returns the decoder converting the charset to UTF-8, nil for UTF-8 itself
+func charsetDecoder(charset string) *encoding.Decoder {
+	switch charset {
+	case charsetUTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder()
+	case charsetUTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder()
+	case charsetLatin1:
+		return charmap.ISO8859_1.NewDecoder()
+	}
+	return nil
+}
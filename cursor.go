@@ -0,0 +1,60 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// errInvalidCursor is returned for cursors that are malformed or were tampered with
+var errInvalidCursor = errors.New("invalid pagination cursor")
+
+// EncodeCursor() encodes v as an opaque pagination cursor: base64url encoded JSON
+// followed by an HMAC-SHA256 signature made with CursorSecret
+func (t *Tools) EncodeCursor(v interface{}) (string, error) {
+	if len(t.CursorSecret) == 0 {
+		return "", errors.New("CursorSecret must be set to encode cursors")
+	}
+
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + t.signCursor(encoded), nil
+}
+
+// DecodeCursor() verifies the signature of a cursor made by EncodeCursor and decodes it into dst
+func (t *Tools) DecodeCursor(token string, dst interface{}) error {
+	if len(t.CursorSecret) == 0 {
+		return errors.New("CursorSecret must be set to decode cursors")
+	}
+
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return errInvalidCursor
+	}
+
+	// Compare in constant time to avoid leaking the expected signature
+	if !hmac.Equal([]byte(signature), []byte(t.signCursor(encoded))) {
+		return errInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return errInvalidCursor
+	}
+
+	return json.Unmarshal(payload, dst)
+}
+
+// signCursor returns the base64url encoded HMAC-SHA256 of the encoded payload
+func (t *Tools) signCursor(encoded string) string {
+	mac := hmac.New(sha256.New, t.CursorSecret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
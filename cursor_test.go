@@ -0,0 +1,59 @@
+package toolkit
+
+import (
+	"strings"
+	"testing"
+)
+
+type testCursor struct {
+	LastID    int    `json:"last_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+func TestTools_EncodeCursor(t *testing.T) {
+	tools := Tools{CursorSecret: []byte("secret")}
+	cursor := testCursor{LastID: 42, CreatedAt: "2024-05-17T10:00:00Z"}
+
+	token, err := tools.EncodeCursor(cursor)
+	if err != nil {
+		t.Fatalf("expected no error, but received %+v", err)
+	}
+
+	tampered := []byte(token)
+	tampered[3] ^= 1
+
+	payload, signature, _ := strings.Cut(token, ".")
+
+	tests := []struct {
+		name          string
+		tools         Tools
+		token         string
+		errorExpected bool
+	}{
+		{"Round trip", tools, token, false},
+		{"Tampered payload", tools, string(tampered), true},
+		{"Missing signature", tools, payload, true},
+		{"Swapped signature", tools, signature + "." + payload, true},
+		{"Different secret", Tools{CursorSecret: []byte("other")}, token, true},
+		{"No secret", Tools{}, token, true},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var decoded testCursor
+			err := entry.tools.DecodeCursor(entry.token, &decoded)
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but received none")
+			}
+
+			if !entry.errorExpected {
+				if err != nil {
+					t.Errorf("expected no error, but received %+v", err)
+				}
+				if decoded != cursor {
+					t.Errorf("expected %+v, but received %+v", cursor, decoded)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package toolkit
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// BodyDecoder decodes a request body sent with a Content-Encoding, see BodyDecoders
+type BodyDecoder func(io.Reader) (io.Reader, error)
+
+// decodeBody undoes the Content-Encoding of the request body. gzip and deflate are supported
+// out of the box, further encodings such as br can be added through BodyDecoders
+func (t *Tools) decodeBody(r *http.Request, body io.Reader) (io.Reader, error) {
+	encodings := strings.Split(strings.Join(r.Header.Values("Content-Encoding"), ","), ",")
+
+	// Encodings are listed in the order they were applied, undo them the other way round
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+
+		var err error
+		switch encoding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			body, err = gzip.NewReader(body)
+		case "deflate":
+			body, err = newDeflateReader(body)
+		default:
+			decoder, ok := t.BodyDecoders[encoding]
+			if !ok {
+				return nil, fmt.Errorf("body has an unsupported content encoding %q", encoding)
+			}
+			body, err = decoder(body)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("body is not valid %s: %w", encoding, err)
+		}
+	}
+
+	return body, nil
+}
+
+// newDeflateReader reads deflate bodies, which are zlib streams, but some clients send raw
+// deflate data instead. The zlib header is checked to tell them apart
+func newDeflateReader(body io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(body)
+	header, err := buffered.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	// A zlib header announces the deflate method and is a multiple of 31
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+// ReadBody() reads the whole request body, decompressing it according to its Content-Encoding.
+// Both the body as sent and the decompressed body are limited to MaxDecompressedSize
+func (t *Tools) ReadBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	maxSize := t.MaxDecompressedSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxDecompressedSize
+	}
+
+	body, err := t.decodeBody(r, http.MaxBytesReader(w, r.Body, int64(maxSize)))
+	if err != nil {
+		return nil, err
+	}
+
+	// Read one byte past the limit to detect bodies that expand too much
+	data, err := io.ReadAll(io.LimitReader(body, int64(maxSize)+1))
+	var maxBytesError *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesError) || len(data) > maxSize:
+		return nil, fmt.Errorf("body must not be larger than %d bytes", maxSize)
+	case err != nil:
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -0,0 +1,119 @@
+package toolkit
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// compress encodes the data with one of the compress writers
+func compress(t *testing.T, data []byte, newWriter func(io.Writer) io.WriteCloser) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zlibWriter(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+
+func flateWriter(w io.Writer) io.WriteCloser {
+	fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+	return fw
+}
+
+func TestTools_ReadJSON_ContentEncoding(t *testing.T) {
+	payload := []byte(`{"foo": "bar"}`)
+
+	tests := []struct {
+		name          string
+		encoding      string
+		body          []byte
+		decoders      map[string]BodyDecoder
+		errorExpected string
+	}{
+		{"Deflate", "deflate", compress(t, payload, zlibWriter), nil, ""},
+		{"Raw deflate", "deflate", compress(t, payload, flateWriter), nil, ""},
+		{"Gzip", "gzip", gzipBytes(t, payload), nil, ""},
+		{"Identity", "identity", payload, nil, ""},
+		{"Unsupported brotli", "br", payload, nil, `body has an unsupported content encoding "br"`},
+		{"Registered brotli", "br", payload, map[string]BodyDecoder{"br": func(r io.Reader) (io.Reader, error) { return r, nil }}, ""},
+		{"Corrupt gzip", "gzip", payload, nil, "body is not valid gzip: gzip: invalid header"},
+		{"Too large once decompressed", "deflate", compress(t, []byte(`{"foo": "`+strings.Repeat("a", 2048)+`"}`), zlibWriter), nil, "body must not be larger 1024 bytes"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{MaxJSONSize: 1024, BodyDecoders: entry.decoders}
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(entry.body))
+			req.Header.Set("Content-Encoding", entry.encoding)
+
+			var decoded struct {
+				Foo string `json:"foo"`
+			}
+			err := tools.ReadJSON(httptest.NewRecorder(), req, &decoded)
+			if entry.errorExpected != "" {
+				if err == nil || err.Error() != entry.errorExpected {
+					t.Fatalf("expected error %q, but received %v", entry.errorExpected, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+			if decoded.Foo != "bar" {
+				t.Errorf("expected bar, but received %q", decoded.Foo)
+			}
+		})
+	}
+}
+
+func TestTools_ReadBody(t *testing.T) {
+	payload := []byte("plain text body")
+
+	tests := []struct {
+		name          string
+		encoding      string
+		body          []byte
+		errorExpected bool
+	}{
+		{"Not encoded", "", payload, false},
+		{"Deflate", "deflate", compress(t, payload, zlibWriter), false},
+		{"Gzip then deflate", "gzip, deflate", compress(t, gzipBytes(t, payload), zlibWriter), false},
+		{"Expands beyond the limit", "gzip", gzipBytes(t, make([]byte, 4096)), true},
+		{"Unsupported", "compress", payload, true},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{MaxDecompressedSize: 1024}
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(entry.body))
+			if entry.encoding != "" {
+				req.Header.Set("Content-Encoding", entry.encoding)
+			}
+
+			body, err := tools.ReadBody(httptest.NewRecorder(), req)
+			if entry.errorExpected {
+				if err == nil {
+					t.Error("expected an error, but received none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+			if !bytes.Equal(body, payload) {
+				t.Errorf("expected %q, but received %q", payload, body)
+			}
+		})
+	}
+}
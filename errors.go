@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	neturl "net/url"
 	"runtime/debug"
+	"strings"
 )
 
 // The serverError helper writes an error message and stack trace to the errorLog,
@@ -16,9 +18,9 @@ func (t *Tools) ServerError(w http.ResponseWriter, err error) {
 	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
 	// report the file name and line number one step back in the stack trace
 	// to have a clearer idea of where the error actually originated from
-	// set frame depth to 2
+	// set frame depth to 2 (the Logger interface has no frame depth, so a provided logger gets the trace only)
 	if t.ErrorLog != nil {
-		t.ErrorLog.Println(2, trace) // Use provided logger
+		t.ErrorLog.Println(trace) // Use provided logger
 	} else {
 		log.Output(2, trace) // Fallback to default log package
 	}
@@ -36,9 +38,74 @@ func (t *Tools) ClientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
 
+// ClientErrorJSON() works like ClientError, but writes a JSONResponse with Error set to true
+// for API clients. The message defaults to the status text. If the JSON cannot be written before
+// anything was sent, e.g. it is over MaxResponseSize, the plain text error is sent instead
+func (t *Tools) ClientErrorJSON(w http.ResponseWriter, status int, message ...string) {
+	payload := JSONResponse{Error: true, Message: http.StatusText(status)}
+	if len(message) > 0 && message[0] != "" {
+		payload.Message = message[0]
+	}
+
+	// Track the writes, falling back after the header went out would write the response twice
+	sw := &statusWriter{ResponseWriter: w}
+	if err := t.WriteJSON(sw, status, payload); err != nil && sw.status == 0 {
+		t.ClientError(w, status)
+	}
+}
+
 // For consistency, we'll also implement a notFound helper. This is simply a
 // convenience wrapper around clientError which sends a 404 Not Found
 // response to the user.
 func (t *Tools) NotFound(w http.ResponseWriter) {
 	t.ClientError(w, http.StatusNotFound)
 }
+
+// Redirect() redirects the client to the url with the given status. Statuses that are not redirects,
+// such as 200 or 304, are replaced by 302 Found. When AllowedRedirectHosts is set, absolute urls must
+// point to the host of the request or to one of the allowed hosts, other targets get 400 Bad Request.
+// This guards against open redirects through user supplied urls such as ?next=
+func (t *Tools) Redirect(w http.ResponseWriter, r *http.Request, url string, status int) {
+	switch status {
+	case http.StatusMultipleChoices, http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		status = http.StatusFound
+	}
+
+	if len(t.AllowedRedirectHosts) > 0 && !t.redirectAllowed(r, url) {
+		t.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, url, status)
+}
+
+// redirectAllowed reports whether the target is relative or points to an allowed host
+func (t *Tools) redirectAllowed(r *http.Request, target string) bool {
+	// Browsers treat backslashes like slashes, /\evil.com would leave the site
+	target = strings.ReplaceAll(strings.TrimSpace(target), `\`, "/")
+
+	u, err := neturl.Parse(target)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" && u.Host == "" {
+		// A path on the same site
+		return true
+	}
+	if (u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == t.Hostname(r) {
+		return true
+	}
+	for _, allowed := range t.AllowedRedirectHosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
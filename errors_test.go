@@ -0,0 +1,128 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTools_Redirect(t *testing.T) {
+	allowed := []string{"accounts.example.com"}
+
+	tests := []struct {
+		name             string
+		allowedHosts     []string
+		url              string
+		status           int
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"Same host path", allowed, "/dashboard", http.StatusSeeOther, http.StatusSeeOther, "/dashboard"},
+		{"Same host absolute", allowed, "https://example.com/home", http.StatusFound, http.StatusFound, "https://example.com/home"},
+		{"Allowed host", allowed, "https://accounts.example.com/login", http.StatusTemporaryRedirect, http.StatusTemporaryRedirect, "https://accounts.example.com/login"},
+		{"External host disallowed", allowed, "https://evil.com/phish", http.StatusFound, http.StatusBadRequest, ""},
+		{"Scheme-relative host disallowed", allowed, "//evil.com", http.StatusFound, http.StatusBadRequest, ""},
+		{"Backslash trick disallowed", allowed, `/\evil.com`, http.StatusFound, http.StatusBadRequest, ""},
+		{"Script scheme disallowed", allowed, "javascript:alert(1)", http.StatusFound, http.StatusBadRequest, ""},
+		{"No allowlist", nil, "https://evil.com/", http.StatusMovedPermanently, http.StatusMovedPermanently, "https://evil.com/"},
+		{"Invalid status", nil, "/home", http.StatusOK, http.StatusFound, "/home"},
+		{"Not modified is no redirect", nil, "/home", http.StatusNotModified, http.StatusFound, "/home"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{AllowedRedirectHosts: entry.allowedHosts}
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/login", nil)
+			resp := httptest.NewRecorder()
+
+			tools.Redirect(resp, req, entry.url, entry.status)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("expected status %d, but received %d", entry.expectedStatus, resp.Code)
+			}
+			if location := resp.Header().Get("Location"); location != entry.expectedLocation {
+				t.Errorf("expected Location %q, but received %q", entry.expectedLocation, location)
+			}
+		})
+	}
+}
+
+func TestTools_ClientErrorJSON(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		message         []string
+		expectedMessage string
+	}{
+		{"Default message", http.StatusNotFound, nil, "Not Found"},
+		{"Custom message", http.StatusBadRequest, []string{"the email is missing"}, "the email is missing"},
+		{"Empty message", http.StatusForbidden, []string{""}, "Forbidden"},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			resp := httptest.NewRecorder()
+
+			tools.ClientErrorJSON(resp, entry.status, entry.message...)
+
+			if resp.Code != entry.status {
+				t.Errorf("expected status %d, but received %d", entry.status, resp.Code)
+			}
+			if contentType := resp.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("expected Content-Type application/json, but received %q", contentType)
+			}
+
+			var payload JSONResponse
+			if err := json.Unmarshal(resp.Body.Bytes(), &payload); err != nil {
+				t.Fatalf("expected a valid JSON body, but received %v", err)
+			}
+			if !payload.Error {
+				t.Error("expected the error flag to be true")
+			}
+			if payload.Message != entry.expectedMessage {
+				t.Errorf("expected message %q, but received %q", entry.expectedMessage, payload.Message)
+			}
+		})
+	}
+}
+
+// failingResponseWriter records the response header and fails every body write
+type failingResponseWriter struct {
+	*httptest.ResponseRecorder
+	headerWrites int
+}
+
+func (f *failingResponseWriter) WriteHeader(status int) {
+	f.headerWrites++
+	f.ResponseRecorder.WriteHeader(status)
+}
+
+func (f *failingResponseWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestTools_ClientErrorJSON_Fallback(t *testing.T) {
+	// Nothing was written yet, the plain text error is sent instead
+	tools := Tools{MaxResponseSize: 10}
+	resp := httptest.NewRecorder()
+	tools.ClientErrorJSON(resp, http.StatusBadRequest, "a message longer than the limit")
+
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, but received %d", http.StatusBadRequest, resp.Code)
+	}
+	if body := strings.TrimSpace(resp.Body.String()); body != "Bad Request" {
+		t.Errorf("expected the plain text error, but received %q", body)
+	}
+
+	// The header already went out, it is not written twice
+	var fallbackTools Tools
+	failing := &failingResponseWriter{ResponseRecorder: httptest.NewRecorder()}
+	fallbackTools.ClientErrorJSON(failing, http.StatusNotFound)
+
+	if failing.headerWrites != 1 {
+		t.Errorf("expected the header to be written once, but it was written %d times", failing.headerWrites)
+	}
+}
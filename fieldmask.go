@@ -0,0 +1,126 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ApplyFieldMask() copies the fields listed in mask from src onto dst, a pointer to a struct.
+// Fields are named by their JSON names, nested fields with dots, e.g. "address.city".
+// A masked field missing from src is reset to its zero value, fields not in the mask are
+// left untouched. On error, e.g. for an unknown path, dst is left as it was
+func (t *Tools) ApplyFieldMask(dst interface{}, src map[string]interface{}, mask []string) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("destination must be a non-nil pointer to a struct")
+	}
+
+	// Check every path and convert every value before anything is changed
+	values := make([]reflect.Value, len(mask))
+	for i, path := range mask {
+		fieldType, err := fieldTypeByJSONPath(v.Elem().Type(), path)
+		if err != nil {
+			return err
+		}
+
+		values[i] = reflect.Zero(fieldType)
+		value, found := valueByPath(src, path)
+		if !found {
+			continue
+		}
+
+		// Round trip through JSON to convert the decoded value to the type of the field
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("cannot apply field %q: %w", path, err)
+		}
+		target := reflect.New(fieldType)
+		if err = json.Unmarshal(encoded, target.Interface()); err != nil {
+			return fmt.Errorf("incorrect JSON type for field %q", path)
+		}
+		values[i] = target.Elem()
+	}
+
+	for i, path := range mask {
+		fieldByJSONPath(v.Elem(), path).Set(values[i])
+	}
+	return nil
+}
+
+// fieldTypeByJSONPath returns the type of the struct field at the dotted path of JSON names
+func fieldTypeByJSONPath(typ reflect.Type, path string) (reflect.Type, error) {
+	for _, segment := range strings.Split(path, ".") {
+		// Step into pointers to nested structs
+		if typ.Kind() == reflect.Pointer {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("unknown field mask path %q", path)
+		}
+
+		index, ok := fieldIndexByJSONName(typ, segment)
+		if !ok {
+			return nil, fmt.Errorf("unknown field mask path %q", path)
+		}
+		typ = typ.Field(index).Type
+	}
+	return typ, nil
+}
+
+// fieldByJSONPath returns the struct field at a dotted path checked by fieldTypeByJSONPath,
+// allocating nil pointers to nested structs on the way
+func fieldByJSONPath(v reflect.Value, path string) reflect.Value {
+	for _, segment := range strings.Split(path, ".") {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+
+		index, _ := fieldIndexByJSONName(v.Type(), segment)
+		v = v.Field(index)
+	}
+	return v
+}
+
+// fieldIndexByJSONName finds the exported field encoded under the given JSON name
+func fieldIndexByJSONName(typ reflect.Type, name string) (int, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		structField := typ.Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+
+		tagName, _, _ := strings.Cut(structField.Tag.Get("json"), ",")
+		if tagName == "-" {
+			continue
+		}
+		if tagName == "" {
+			tagName = structField.Name
+		}
+
+		if tagName == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// valueByPath looks up the dotted path in nested JSON objects
+func valueByPath(src map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = src
+	for _, segment := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[segment]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
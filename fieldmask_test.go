@@ -0,0 +1,92 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type maskAddress struct {
+	City    string `json:"city"`
+	Country string `json:"country"`
+}
+
+type maskUser struct {
+	Name    string       `json:"name"`
+	Email   string       `json:"email"`
+	Age     int          `json:"age"`
+	Tags    []string     `json:"tags,omitempty"`
+	Address *maskAddress `json:"address"`
+	Secret  string       `json:"-"`
+}
+
+func TestTools_ApplyFieldMask(t *testing.T) {
+	original := maskUser{
+		Name:    "Ada",
+		Email:   "ada@example.com",
+		Age:     36,
+		Address: &maskAddress{City: "London", Country: "UK"},
+		Secret:  "s3cret",
+	}
+	// The source is decoded the way a PATCH body would be
+	var src map[string]interface{}
+	body := `{"name": "Grace", "email": "grace@example.com", "age": 85, "tags": ["navy"], "address": {"city": "New York"}}`
+	if err := json.Unmarshal([]byte(body), &src); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		mask          []string
+		expected      maskUser
+		errorExpected bool
+	}{
+		{"Only masked fields", []string{"name", "age"}, maskUser{Name: "Grace", Email: "ada@example.com", Age: 85, Address: &maskAddress{City: "London", Country: "UK"}, Secret: "s3cret"}, false},
+		{"Nested field", []string{"address.city"}, maskUser{Name: "Ada", Email: "ada@example.com", Age: 36, Address: &maskAddress{City: "New York", Country: "UK"}, Secret: "s3cret"}, false},
+		{"Missing value is cleared", []string{"address.country"}, maskUser{Name: "Ada", Email: "ada@example.com", Age: 36, Address: &maskAddress{City: "London"}, Secret: "s3cret"}, false},
+		{"Slice field", []string{"tags"}, maskUser{Name: "Ada", Email: "ada@example.com", Age: 36, Tags: []string{"navy"}, Address: &maskAddress{City: "London", Country: "UK"}, Secret: "s3cret"}, false},
+		{"Empty mask", nil, original, false},
+		{"Unknown path", []string{"name", "address.city", "nickname"}, original, true},
+		{"Unknown nested path", []string{"address.zip"}, original, true},
+		{"Ignored field", []string{"Secret"}, original, true},
+	}
+
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			dst := original
+			address := *original.Address
+			dst.Address = &address
+
+			err := tools.ApplyFieldMask(&dst, src, entry.mask)
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but received none")
+			}
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %v", err)
+			}
+
+			if !reflect.DeepEqual(dst, entry.expected) {
+				t.Errorf("expected %+v (%+v), but received %+v (%+v)", entry.expected, entry.expected.Address, dst, dst.Address)
+			}
+		})
+	}
+}
+
+func TestTools_ApplyFieldMask_InvalidInput(t *testing.T) {
+	var tools Tools
+	user := maskUser{Age: 36}
+
+	if err := tools.ApplyFieldMask(user, nil, []string{"age"}); err == nil {
+		t.Error("expected an error for a non-pointer destination, but received none")
+	}
+
+	if err := tools.ApplyFieldMask(&user, map[string]interface{}{"age": "old"}, []string{"age"}); err == nil {
+		t.Error("expected an error for a value of the wrong type, but received none")
+	}
+
+	if user.Age != 36 {
+		t.Errorf("expected age 36 to be kept, but received %d", user.Age)
+	}
+}
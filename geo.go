@@ -0,0 +1,46 @@
+package toolkit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// ParseLatLng() reads a coordinate from the lat and lng query parameters of the request.
+// Returns an error if a parameter is missing, is not a number, or is out of range:
+// latitude must be within [-90, 90] and longitude within [-180, 180]
+func (t *Tools) ParseLatLng(r *http.Request) (lat, lng float64, err error) {
+	query := r.URL.Query()
+
+	lat, err = parseCoordinate(query.Get("lat"), "lat", 90)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	lng, err = parseCoordinate(query.Get("lng"), "lng", 180)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return lat, lng, nil
+}
+
+// parseCoordinate parses the value of a coordinate parameter and checks it is within [-limit, limit]
+func parseCoordinate(value, name string, limit float64) (float64, error) {
+	if value == "" {
+		return 0, fmt.Errorf("missing %s parameter", name)
+	}
+
+	coordinate, err := strconv.ParseFloat(value, 64)
+	// ParseFloat accepts NaN and Inf, which are not coordinates
+	if err != nil || math.IsNaN(coordinate) || math.IsInf(coordinate, 0) {
+		return 0, fmt.Errorf("%s must be a number", name)
+	}
+
+	if coordinate < -limit || coordinate > limit {
+		return 0, fmt.Errorf("%s must be between %g and %g", name, -limit, limit)
+	}
+
+	return coordinate, nil
+}
@@ -0,0 +1,49 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTools_ParseLatLng(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		lat           float64
+		lng           float64
+		errorExpected string
+	}{
+		{"Valid", "lat=52.52&lng=13.405", 52.52, 13.405, ""},
+		{"Negative", "lat=-33.8688&lng=-151.2093", -33.8688, -151.2093, ""},
+		{"Bounds", "lat=90&lng=-180", 90, -180, ""},
+		{"Missing lat", "lng=13.405", 0, 0, "missing lat parameter"},
+		{"Missing lng", "lat=52.52", 0, 0, "missing lng parameter"},
+		{"Lat out of range", "lat=90.1&lng=0", 0, 0, "lat must be between -90 and 90"},
+		{"Lng out of range", "lat=0&lng=181", 0, 0, "lng must be between -180 and 180"},
+		{"Malformed lat", "lat=north&lng=0", 0, 0, "lat must be a number"},
+		{"NaN lng", "lat=0&lng=NaN", 0, 0, "lng must be a number"},
+		{"Infinite lat", "lat=Inf&lng=0", 0, 0, "lat must be a number"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			req := httptest.NewRequest(http.MethodGet, "/places?"+entry.query, nil)
+
+			lat, lng, err := tools.ParseLatLng(req)
+			if entry.errorExpected != "" {
+				if err == nil || err.Error() != entry.errorExpected {
+					t.Fatalf("expected error %q, but received %v", entry.errorExpected, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			if lat != entry.lat || lng != entry.lng {
+				t.Errorf("expected %v,%v, but received %v,%v", entry.lat, entry.lng, lat, lng)
+			}
+		})
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/kweeuhree/toolkit
 
 go 1.23.4
+
+require golang.org/x/text v0.24.0
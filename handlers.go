@@ -0,0 +1,188 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// RequestEcho is the JSON payload written by EchoRequest
+type RequestEcho struct {
+	Method   string              `json:"method"`
+	URL      string              `json:"url"`
+	Headers  map[string][]string `json:"headers"`
+	ClientIP string              `json:"client_ip"`
+	BodySize int64               `json:"body_size"`
+}
+
+// VersionInfo describes the running build, written by VersionHandler.
+// GoVersion is filled in by the handler
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// redactedValue replaces the values of sensitive headers
+const redactedValue = "[REDACTED]"
+
+// defaultRedactedHeaders are redacted when RedactedHeaders is not set
+var defaultRedactedHeaders = []string{"Authorization", "Cookie"}
+
+// EchoRequest() writes back a JSON description of the received request.
+// Sensitive headers are redacted, see RedactedHeaders.
+// Useful for debugging endpoints such as /debug/echo
+func (t *Tools) EchoRequest(w http.ResponseWriter, r *http.Request) {
+	// Use the default list of sensitive headers if none was provided
+	redacted := defaultRedactedHeaders
+	if len(t.RedactedHeaders) > 0 {
+		redacted = t.RedactedHeaders
+	}
+
+	// Copy the headers, replacing sensitive values
+	headers := make(map[string][]string, len(r.Header))
+	for name, values := range r.Header {
+		headers[name] = values
+		for _, sensitive := range redacted {
+			if strings.EqualFold(name, sensitive) {
+				headers[name] = []string{redactedValue}
+				break
+			}
+		}
+	}
+
+	// Count the body bytes without keeping them in memory
+	var bodySize int64
+	if r.Body != nil {
+		bodySize, _ = io.Copy(io.Discard, r.Body)
+	}
+
+	echo := RequestEcho{
+		Method:   r.Method,
+		URL:      r.URL.String(),
+		Headers:  headers,
+		ClientIP: t.GetClientIP(r),
+		BodySize: bodySize,
+	}
+
+	if err := t.WriteJSON(w, http.StatusOK, echo); err != nil {
+		t.ServerError(w, err)
+	}
+}
+
+// NoContentHandler() returns a handler that responds with 204 No Content.
+// Mount it on routes that browsers request on their own to keep 404s out of the logs
+func (t *Tools) NoContentHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// FaviconHandler() returns a handler that serves the icon at the provided path.
+// If no path is set or the icon does not exist, it responds with 204 No Content
+func (t *Tools) FaviconHandler(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if path == "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		http.ServeFile(w, r, path)
+	}
+}
+
+// VersionHandler() returns a handler that writes the build information as JSON.
+// The fields are usually set at build time with -ldflags, the Go version is added from the runtime
+func (t *Tools) VersionHandler(info VersionInfo) http.HandlerFunc {
+	info.GoVersion = runtime.Version()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := t.WriteJSON(w, http.StatusOK, info); err != nil {
+			t.ServerError(w, err)
+		}
+	}
+}
+
+// ServeEmbedded() serves the named file from a file system such as an embed.FS.
+// http.ServeContent answers range and conditional requests, using the modification time of the file
+// and a strong ETag of its content. Missing files and directories are answered with 404 Not Found,
+// and the error is returned so it can be logged
+func (t *Tools) ServeEmbedded(w http.ResponseWriter, r *http.Request, fsys fs.FS, name string) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		t.NotFound(w)
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		t.ServerError(w, err)
+		return err
+	}
+	if info.IsDir() {
+		t.NotFound(w)
+		return fmt.Errorf("%s is a directory", name)
+	}
+
+	// ServeContent needs to seek, files of embed.FS can, others are read into memory
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			t.ServerError(w, err)
+			return err
+		}
+		content = bytes.NewReader(data)
+	}
+
+	// Hash the content for the ETag, then go back to the beginning
+	hash := sha256.New()
+	if _, err = io.Copy(hash, content); err != nil {
+		t.ServerError(w, err)
+		return err
+	}
+	if _, err = content.Seek(0, io.SeekStart); err != nil {
+		t.ServerError(w, err)
+		return err
+	}
+	w.Header().Set("ETag", fmt.Sprintf("%q", hex.EncodeToString(hash.Sum(nil))))
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+	return nil
+}
+
+// DebugHandler() serves the net/http/pprof profiling endpoints under /debug/pprof/, but only
+// for requests the auth callback approves. Other requests get 403 Forbidden, and so does
+// every request when auth is nil. Mount it at "/debug/pprof/"
+func (t *Tools) DebugHandler(auth func(*http.Request) bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index) // Also serves the named profiles, e.g. heap
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth == nil || !auth(r) {
+			t.ClientError(w, http.StatusForbidden)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,218 @@
+package toolkit
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestTools_EchoRequest(t *testing.T) {
+	tests := []struct {
+		name            string
+		redactedHeaders []string
+		header          string
+		value           string
+		expected        string
+	}{
+		{"Authorization is redacted", nil, "Authorization", "Bearer secret", redactedValue},
+		{"Cookie is redacted", nil, "Cookie", "session=secret", redactedValue},
+		{"Regular header is kept", nil, "X-Request-Id", "abc", "abc"},
+		{"Custom redacted header", []string{"X-Api-Key"}, "X-Api-Key", "secret", redactedValue},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{RedactedHeaders: entry.redactedHeaders}
+
+			req := httptest.NewRequest(http.MethodPost, "/debug/echo?foo=bar", strings.NewReader("hello"))
+			req.Header.Set(entry.header, entry.value)
+			req.RemoteAddr = "10.0.0.1:1234"
+			resp := httptest.NewRecorder()
+
+			tools.EchoRequest(resp, req)
+
+			var echo RequestEcho
+			if err := json.NewDecoder(resp.Body).Decode(&echo); err != nil {
+				t.Fatal("received error when decoding JSON:", err)
+			}
+
+			if got := echo.Headers[entry.header][0]; got != entry.expected {
+				t.Errorf("expected header value %s, but received %s", entry.expected, got)
+			}
+
+			if echo.BodySize != 5 {
+				t.Errorf("expected body size 5, but received %d", echo.BodySize)
+			}
+
+			if echo.ClientIP != "10.0.0.1" {
+				t.Errorf("expected client IP 10.0.0.1, but received %s", echo.ClientIP)
+			}
+
+			if echo.Method != http.MethodPost || echo.URL != "/debug/echo?foo=bar" {
+				t.Errorf("unexpected request line %s %s", echo.Method, echo.URL)
+			}
+		})
+	}
+}
+
+func TestTools_NoContentHandler(t *testing.T) {
+	var tools Tools
+	req := httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+	resp := httptest.NewRecorder()
+
+	tools.NoContentHandler()(resp, req)
+
+	if resp.Code != http.StatusNoContent {
+		t.Errorf("expected status code %d, but received %d", http.StatusNoContent, resp.Code)
+	}
+}
+
+func TestTools_FaviconHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   bool
+	}{
+		{"Configured favicon", "./testdata/img.png", http.StatusOK, true},
+		{"No favicon", "", http.StatusNoContent, false},
+		{"Missing favicon", "./testdata/missing.ico", http.StatusNoContent, false},
+	}
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/favicon.ico", nil)
+			resp := httptest.NewRecorder()
+
+			tools.FaviconHandler(entry.path)(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("expected status code %d, but received %d", entry.expectedStatus, resp.Code)
+			}
+
+			if (resp.Body.Len() > 0) != entry.expectedBody {
+				t.Errorf("expected body %t, but received %d bytes", entry.expectedBody, resp.Body.Len())
+			}
+		})
+	}
+}
+
+func TestTools_VersionHandler(t *testing.T) {
+	var tools Tools
+	info := VersionInfo{Version: "v1.2.3", Commit: "abc1234", BuildTime: "2024-01-02T03:04:05Z"}
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	resp := httptest.NewRecorder()
+	tools.VersionHandler(info)(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("expected status code %d, but received %d", http.StatusOK, resp.Code)
+	}
+
+	var received VersionInfo
+	if err := json.NewDecoder(resp.Body).Decode(&received); err != nil {
+		t.Fatal("received error when decoding JSON:", err)
+	}
+
+	info.GoVersion = runtime.Version()
+	if received != info {
+		t.Errorf("expected %+v, but received %+v", info, received)
+	}
+}
+
+//go:embed testdata/img.png
+var embeddedFS embed.FS
+
+func TestTools_ServeEmbedded(t *testing.T) {
+	const etag = `"80728a5f476d2d62dbaa1da211e98ea7af78d7c2d536cb1ba520bec32b465b73"`
+	tests := []struct {
+		name           string
+		fileName       string
+		headers        map[string]string
+		expectedStatus int
+		expectedLength int
+		errorExpected  bool
+	}{
+		{"Whole file", "testdata/img.png", nil, http.StatusOK, 5003, false},
+		{"Range", "testdata/img.png", map[string]string{"Range": "bytes=0-99"}, http.StatusPartialContent, 100, false},
+		{"Matching ETag", "testdata/img.png", map[string]string{"If-None-Match": etag}, http.StatusNotModified, 0, false},
+		{"Missing file", "testdata/missing.png", nil, http.StatusNotFound, -1, true},
+		{"Directory", "testdata", nil, http.StatusNotFound, -1, true},
+	}
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/assets/"+entry.fileName, nil)
+			for name, value := range entry.headers {
+				req.Header.Set(name, value)
+			}
+			resp := httptest.NewRecorder()
+
+			err := tools.ServeEmbedded(resp, req, embeddedFS, entry.fileName)
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but received none")
+			}
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %v", err)
+			}
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("expected status code %d, but received %d", entry.expectedStatus, resp.Code)
+			}
+
+			if entry.expectedLength >= 0 && resp.Body.Len() != entry.expectedLength {
+				t.Errorf("expected %d bytes, but received %d", entry.expectedLength, resp.Body.Len())
+			}
+
+			if !entry.errorExpected && resp.Header().Get("ETag") != etag {
+				t.Errorf("expected ETag %s, but received %s", etag, resp.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestTools_DebugHandler(t *testing.T) {
+	auth := func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer secret"
+	}
+
+	tests := []struct {
+		name           string
+		auth           func(*http.Request) bool
+		path           string
+		authorization  string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Authorized index", auth, "/debug/pprof/", "Bearer secret", http.StatusOK, "goroutine"},
+		{"Authorized profile", auth, "/debug/pprof/goroutine?debug=1", "Bearer secret", http.StatusOK, "goroutine profile"},
+		{"Authorized cmdline", auth, "/debug/pprof/cmdline", "Bearer secret", http.StatusOK, ""},
+		{"Unauthorized", auth, "/debug/pprof/", "Bearer wrong", http.StatusForbidden, "Forbidden"},
+		{"Missing credentials", auth, "/debug/pprof/heap", "", http.StatusForbidden, "Forbidden"},
+		{"No auth callback", nil, "/debug/pprof/", "Bearer secret", http.StatusForbidden, "Forbidden"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			req := httptest.NewRequest(http.MethodGet, entry.path, nil)
+			if entry.authorization != "" {
+				req.Header.Set("Authorization", entry.authorization)
+			}
+			rr := httptest.NewRecorder()
+
+			tools.DebugHandler(entry.auth).ServeHTTP(rr, req)
+
+			if rr.Code != entry.expectedStatus {
+				t.Errorf("expected status %d, but received %d", entry.expectedStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), entry.expectedBody) {
+				t.Errorf("expected body to contain %q, but received %q", entry.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package toolkit
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// crockfordAlphabet is the Crockford base32 alphabet, which excludes I, L, O and U
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const (
+	timeSortableIDLength = 26 // 10 characters of timestamp and 16 of entropy
+	timestampLength      = 10
+	entropyBytes         = 10 // 80 bits, encoded as 16 characters
+)
+
+// lastID keeps the state needed to order IDs created within the same millisecond
+var lastID struct {
+	sync.Mutex
+	ms      uint64
+	entropy [entropyBytes]byte
+}
+
+// TimeSortableID() returns a 26 character ULID-like ID: a millisecond timestamp followed
+// by 80 bits of crypto/rand entropy, both Crockford base32 encoded. IDs sort lexically in
+// creation order, IDs created within the same millisecond increment the previous entropy
+func (t *Tools) TimeSortableID() string {
+	lastID.Lock()
+	defer lastID.Unlock()
+
+	ms := uint64(time.Now().UnixMilli())
+	if ms <= lastID.ms && incrementEntropy(&lastID.entropy) {
+		// Same millisecond (or a clock going backwards): keep the previous timestamp
+		ms = lastID.ms
+	} else {
+		// Entropy overflowed, move on to the next millisecond
+		ms = max(ms, lastID.ms+1)
+		rand.Read(lastID.entropy[:])
+	}
+	lastID.ms = ms
+
+	id := make([]byte, timeSortableIDLength)
+	// Encode the 48-bit timestamp in 10 characters, the most significant first
+	for i := timestampLength - 1; i >= 0; i-- {
+		id[i] = crockfordAlphabet[ms&0x1F]
+		ms >>= 5
+	}
+	// Encode the 80 bits of entropy 5 bits at a time
+	for i := 0; i < 16; i++ {
+		id[timestampLength+i] = crockfordAlphabet[entropyBits(lastID.entropy, i*5)]
+	}
+
+	return string(id)
+}
+
+// ParseTimeSortableID() returns the creation time encoded in an ID from TimeSortableID
+func (t *Tools) ParseTimeSortableID(id string) (time.Time, error) {
+	if len(id) != timeSortableIDLength {
+		return time.Time{}, errors.New("invalid ID length")
+	}
+
+	var ms uint64
+	for i, c := range strings.ToUpper(id) {
+		value := strings.IndexRune(crockfordAlphabet, c)
+		if value < 0 {
+			return time.Time{}, errors.New("invalid character in ID")
+		}
+		if i < timestampLength {
+			ms = ms<<5 | uint64(value)
+		}
+	}
+
+	// The timestamp is limited to 48 bits
+	if ms >= 1<<48 {
+		return time.Time{}, errors.New("ID timestamp out of range")
+	}
+
+	return time.UnixMilli(int64(ms)), nil
+}
+
+// entropyBits returns the 5 bits starting at the given bit offset
+func entropyBits(entropy [entropyBytes]byte, offset int) byte {
+	var value byte
+	for bit := offset; bit < offset+5; bit++ {
+		value = value<<1 | (entropy[bit/8]>>(7-bit%8))&1
+	}
+	return value
+}
+
+// incrementEntropy adds one to the entropy, reporting false on overflow
+func incrementEntropy(entropy *[entropyBytes]byte) bool {
+	for i := entropyBytes - 1; i >= 0; i-- {
+		entropy[i]++
+		if entropy[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package toolkit
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestTools_TimeSortableID(t *testing.T) {
+	var tools Tools
+
+	ids := make([]string, 1000)
+	for i := range ids {
+		id := tools.TimeSortableID()
+		if len(id) != 26 {
+			t.Fatalf("expected length 26, received %d", len(id))
+		}
+		ids[i] = id
+	}
+
+	// Lexical order must match creation order, even within the same millisecond
+	if !sort.StringsAreSorted(ids) {
+		t.Error("expected IDs to sort in creation order")
+	}
+
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			t.Fatalf("duplicate ID %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestTools_ParseTimeSortableID(t *testing.T) {
+	var tools Tools
+
+	before := time.Now().Truncate(time.Millisecond)
+	id := tools.TimeSortableID()
+	after := time.Now()
+
+	created, err := tools.ParseTimeSortableID(id)
+	if err != nil {
+		t.Fatalf("expected no error, but received %+v", err)
+	}
+	if created.Before(before) || created.After(after) {
+		t.Errorf("expected a timestamp between %s and %s, received %s", before, after, created)
+	}
+
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{"Too short", "01ARZ3NDEK"},
+		{"Invalid character", "01ARZ3NDEKTSV4RRFFQ69G5FAU"},
+		{"Timestamp overflow", "81ARZ3NDEKTSV4RRFFQ69G5FAV"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			if _, err := tools.ParseTimeSortableID(entry.id); err == nil {
+				t.Error("expected an error, but received none")
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package toolkit
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultIdempotencyTTL is used when IdempotencyTTL is not set
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// idempotencyPendingTTL bounds how long a key stays reserved for a request in progress,
+// so that a crashed instance cannot block the key until IdempotencyTTL runs out
+var idempotencyPendingTTL = 5 * time.Minute
+
+// idempotencySweepInterval is how often MemoryIdempotencyStore drops its expired entries
+var idempotencySweepInterval = time.Minute
+
+// CachedResponse is a response captured by the Idempotency middleware.
+// A Status of 0 marks a key reserved by a request that is still in progress
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore stores captured responses by idempotency key.
+// Implementations must be safe for concurrent use
+type IdempotencyStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, resp *CachedResponse, ttl time.Duration)
+	// SetIfAbsent stores the response only if the key has no unexpired entry, reporting whether
+	// it did. It must be atomic, e.g. SET NX in Redis, since it keeps concurrent requests apart
+	SetIfAbsent(key string, resp *CachedResponse, ttl time.Duration) bool
+	// Delete removes the entry of the key, releasing the reservation of a request that failed
+	Delete(key string)
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore, suitable for a single instance
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryIdempotencyEntry
+	lastSweep time.Time
+}
+
+type memoryIdempotencyEntry struct {
+	resp      *CachedResponse
+	expiresAt time.Time
+}
+
+// NewMemoryIdempotencyStore() creates an empty in-memory store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: make(map[string]memoryIdempotencyEntry), lastSweep: time.Now()}
+}
+
+// Get() returns the response stored under the key, unless it has expired
+func (s *MemoryIdempotencyStore) Get(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(s.entries, key)
+		return nil, false
+	}
+	return entry.resp, true
+}
+
+// Set() stores the response under the key for the duration of ttl
+func (s *MemoryIdempotencyStore) Set(key string, resp *CachedResponse, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	s.entries[key] = memoryIdempotencyEntry{resp: resp, expiresAt: now.Add(ttl)}
+}
+
+// SetIfAbsent() stores the response under the key for the duration of ttl, unless the key
+// already has an unexpired entry. Reports whether the response was stored
+func (s *MemoryIdempotencyStore) SetIfAbsent(key string, resp *CachedResponse, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	if entry, ok := s.entries[key]; ok && !now.After(entry.expiresAt) {
+		return false
+	}
+	s.entries[key] = memoryIdempotencyEntry{resp: resp, expiresAt: now.Add(ttl)}
+	return true
+}
+
+// Delete() removes the entry of the key
+func (s *MemoryIdempotencyStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+}
+
+// sweep drops the expired entries to keep the map from growing. It runs at most once per
+// idempotencySweepInterval, so that a write does not scan the map every time.
+// The caller must hold the lock
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < idempotencySweepInterval {
+		return
+	}
+	for k, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	s.lastSweep = now
+}
+
+// captureWriter writes the response through while keeping a copy of it
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *captureWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+// Flush() forwards to the underlying writer, so streaming handlers can still assert http.Flusher
+func (c *captureWriter) Flush() {
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		// Flushing sends the header, 200 OK unless the handler set a status
+		if c.status == 0 {
+			c.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// Unwrap() gives http.ResponseController access to the underlying writer
+func (c *captureWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// Idempotency() replays the stored response for requests carrying an Idempotency-Key header
+// that was already seen for the same method and path. The key is reserved before the handler
+// runs, a request repeating a key that is still in progress gets 409 Conflict. The first response
+// for a key is captured and stored for IdempotencyTTL (24 hours by default). Server errors are
+// not stored, so the request can be retried. Replayed responses carry an Idempotent-Replayed header
+func (t *Tools) Idempotency(store IdempotencyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Scope the key to the endpoint so keys cannot collide across routes
+			storeKey := r.Method + " " + r.URL.Path + " " + key
+
+			// Reserve the key, only one request can run the handler for it
+			if !store.SetIfAbsent(storeKey, &CachedResponse{}, idempotencyPendingTTL) {
+				cached, ok := store.Get(storeKey)
+				if !ok || cached.Status == 0 {
+					// The first request is still in progress
+					t.ClientError(w, http.StatusConflict)
+					return
+				}
+
+				for name, values := range cached.Header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(cached.Status)
+				w.Write(cached.Body)
+				return
+			}
+
+			// Release the key if the response is not stored, e.g. after a panic
+			stored := false
+			defer func() {
+				if !stored {
+					store.Delete(storeKey)
+				}
+			}()
+
+			capture := &captureWriter{ResponseWriter: w}
+			next.ServeHTTP(capture, r)
+
+			if capture.status == 0 {
+				capture.status = http.StatusOK
+			}
+			if capture.status >= http.StatusInternalServerError {
+				return
+			}
+
+			ttl := t.IdempotencyTTL
+			if ttl == 0 {
+				ttl = defaultIdempotencyTTL
+			}
+			store.Set(storeKey, &CachedResponse{
+				Status: capture.status,
+				Header: w.Header().Clone(),
+				Body:   capture.body.Bytes(),
+			}, ttl)
+			stored = true
+		})
+	}
+}
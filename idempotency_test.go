@@ -0,0 +1,205 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTools_Idempotency(t *testing.T) {
+	var tools Tools
+	calls := 0
+	handler := tools.Idempotency(NewMemoryIdempotencyStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-Order-Id", fmt.Sprint(calls))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "order %d", calls)
+	}))
+
+	post := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	tests := []struct {
+		name          string
+		path          string
+		key           string
+		expectedBody  string
+		expectedCalls int
+		replayed      bool
+	}{
+		{"First request", "/orders", "abc", "order 1", 1, false},
+		{"Repeated key is replayed", "/orders", "abc", "order 1", 1, true},
+		{"New key", "/orders", "def", "order 2", 2, false},
+		{"Same key on another path", "/payments", "abc", "order 3", 3, false},
+		{"No key", "/orders", "", "order 4", 4, false},
+	}
+	for _, entry := range tests {
+		resp := post(entry.path, entry.key)
+
+		if resp.Code != http.StatusCreated {
+			t.Errorf("%s: expected status code %d, but received %d", entry.name, http.StatusCreated, resp.Code)
+		}
+
+		if resp.Body.String() != entry.expectedBody {
+			t.Errorf("%s: expected body %s, but received %s", entry.name, entry.expectedBody, resp.Body.String())
+		}
+
+		if calls != entry.expectedCalls {
+			t.Errorf("%s: expected %d handler calls, but received %d", entry.name, entry.expectedCalls, calls)
+		}
+
+		if (resp.Header().Get("Idempotent-Replayed") == "true") != entry.replayed {
+			t.Errorf("%s: expected replayed to be %t", entry.name, entry.replayed)
+		}
+	}
+
+	// Replayed responses keep the original headers
+	if resp := post("/orders", "abc"); resp.Header().Get("X-Order-Id") != "1" {
+		t.Errorf("expected header X-Order-Id 1, but received %s", resp.Header().Get("X-Order-Id"))
+	}
+}
+
+func TestMemoryIdempotencyStore_Expiry(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	store.Set("key", &CachedResponse{Status: http.StatusOK}, 10*time.Millisecond)
+
+	if _, ok := store.Get("key"); !ok {
+		t.Error("expected the response to be stored")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := store.Get("key"); ok {
+		t.Error("expected the response to expire")
+	}
+}
+
+func TestTools_Idempotency_InProgress(t *testing.T) {
+	var tools Tools
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	handler := tools.Idempotency(NewMemoryIdempotencyStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		req.Header.Set("Idempotency-Key", "abc")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- post() }()
+	<-started
+
+	// The key is reserved while the first request runs
+	if resp := post(); resp.Code != http.StatusConflict {
+		t.Errorf("expected status code %d, but received %d", http.StatusConflict, resp.Code)
+	}
+
+	close(release)
+	if resp := <-first; resp.Code != http.StatusCreated {
+		t.Errorf("expected status code %d, but received %d", http.StatusCreated, resp.Code)
+	}
+
+	// Once done, the response is replayed
+	if resp := post(); resp.Code != http.StatusCreated || resp.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected a replayed %d, but received %d", http.StatusCreated, resp.Code)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected 1 handler call, but received %d", n)
+	}
+}
+
+func TestTools_Idempotency_ReleasesKey(t *testing.T) {
+	var tools Tools
+	store := NewMemoryIdempotencyStore()
+	calls := 0
+	handler := tools.Idempotency(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		case 2:
+			panic("handler failed")
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	handler = tools.RecoverPanic(handler)
+
+	tests := []struct {
+		name           string
+		expectedStatus int
+	}{
+		{"Server error", http.StatusInternalServerError},
+		{"Panic", http.StatusInternalServerError},
+		{"Retry succeeds", http.StatusCreated},
+	}
+	for _, entry := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		req.Header.Set("Idempotency-Key", "abc")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != entry.expectedStatus {
+			t.Errorf("%s: expected status code %d, but received %d", entry.name, entry.expectedStatus, resp.Code)
+		}
+	}
+}
+
+func TestMemoryIdempotencyStore_SetIfAbsent(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+
+	if !store.SetIfAbsent("key", &CachedResponse{}, time.Minute) {
+		t.Error("expected the first reservation to succeed")
+	}
+	if store.SetIfAbsent("key", &CachedResponse{Status: http.StatusOK}, time.Minute) {
+		t.Error("expected the second reservation to fail")
+	}
+
+	store.Delete("key")
+	if !store.SetIfAbsent("key", &CachedResponse{}, 10*time.Millisecond) {
+		t.Error("expected the reservation to succeed after Delete")
+	}
+
+	// An expired entry does not block the key
+	time.Sleep(20 * time.Millisecond)
+	if !store.SetIfAbsent("key", &CachedResponse{}, time.Minute) {
+		t.Error("expected the reservation to succeed after expiry")
+	}
+}
+
+func TestMemoryIdempotencyStore_Sweep(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	store.Set("old", &CachedResponse{Status: http.StatusOK}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	// Expired entries stay until the sweep interval has passed
+	store.Set("new", &CachedResponse{Status: http.StatusOK}, time.Minute)
+	if len(store.entries) != 2 {
+		t.Errorf("expected 2 entries before the sweep, but received %d", len(store.entries))
+	}
+
+	store.lastSweep = time.Now().Add(-idempotencySweepInterval)
+	store.Set("newer", &CachedResponse{Status: http.StatusOK}, time.Minute)
+	if _, ok := store.entries["old"]; ok || len(store.entries) != 2 {
+		t.Errorf("expected the expired entry to be swept, but received %d entries", len(store.entries))
+	}
+}
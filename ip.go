@@ -0,0 +1,29 @@
+package toolkit
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// CanonicalIP() validates an IPv4 or IPv6 address and returns its canonical text form, e.g. for
+// storing the result of GetClientIP. IPv6 is lower case with the longest run of zeros collapsed,
+// and IPv4 addresses mapped into IPv6 such as ::ffff:192.168.0.1 are returned as plain IPv4
+func (t *Tools) CanonicalIP(s string) (string, error) {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip == nil {
+		return "", fmt.Errorf("%q is not a valid IP address", s)
+	}
+	return ip.String(), nil
+}
+
+// IsPrivateIP() reports whether the address belongs to internal traffic: the private ranges
+// (10.0.0.0/8, 172.16.0.0/12, 192.168.0.0/16 and fc00::/7), loopback and link-local addresses.
+// Invalid addresses are not private
+func (t *Tools) IsPrivateIP(s string) bool {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip == nil {
+		return false
+	}
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()
+}
@@ -0,0 +1,71 @@
+package toolkit
+
+import "testing"
+
+func TestTools_CanonicalIP(t *testing.T) {
+	var tools Tools
+	tests := []struct {
+		name          string
+		ip            string
+		expected      string
+		errorExpected bool
+	}{
+		{"IPv4", "192.168.0.1", "192.168.0.1", false},
+		{"IPv4 mapped into IPv6", "::ffff:192.168.0.1", "192.168.0.1", false},
+		{"Expanded IPv6", "2001:0DB8:0000:0000:0000:0000:0000:0001", "2001:db8::1", false},
+		{"Loopback IPv6", "0:0:0:0:0:0:0:1", "::1", false},
+		{"Surrounding spaces", " 10.0.0.1 ", "10.0.0.1", false},
+		{"Leading zeros", "192.168.000.001", "", true},
+		{"Out of range", "256.1.1.1", "", true},
+		{"Hostname", "example.com", "", true},
+		{"Empty", "", "", true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			result, err := tools.CanonicalIP(entry.ip)
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but received none")
+			}
+
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %+v", err)
+			}
+
+			if result != entry.expected {
+				t.Errorf("expected %q, but received %q", entry.expected, result)
+			}
+		})
+	}
+}
+
+func TestTools_IsPrivateIP(t *testing.T) {
+	var tools Tools
+	tests := []struct {
+		name     string
+		ip       string
+		expected bool
+	}{
+		{"Class A private", "10.1.2.3", true},
+		{"Class B private", "172.16.5.4", true},
+		{"Outside class B private", "172.32.0.1", false},
+		{"Class C private", "192.168.0.1", true},
+		{"Mapped private", "::ffff:192.168.0.1", true},
+		{"Loopback", "127.0.0.1", true},
+		{"IPv6 loopback", "::1", true},
+		{"Link-local", "169.254.10.1", true},
+		{"Unique local IPv6", "fd12:3456::1", true},
+		{"Public IPv4", "8.8.8.8", false},
+		{"Public IPv6", "2001:4860:4860::8888", false},
+		{"Invalid", "not an ip", false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			if result := tools.IsPrivateIP(entry.ip); result != entry.expected {
+				t.Errorf("expected %t for %s, but received %t", entry.expected, entry.ip, result)
+			}
+		})
+	}
+}
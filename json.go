@@ -1,40 +1,70 @@
 package toolkit
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"reflect"
+	"strconv"
 	"strings"
 )
 
 type JSONResponse struct {
 	Error   bool        `json:"error"`
 	Message string      `json:"message"`
+	Code    string      `json:"code,omitempty"` // Machine-readable error code, set by ErrorJSONWithCode
 	Data    interface{} `json:"data,omitempty"` // Do not include if empty with omitempty
 }
 
+// ItemResult is the outcome of a single item of a batch operation, written by WriteMultiStatus
+type ItemResult struct {
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"` // Do not include if the item succeeded
+}
+
 // ReadJSON reads and decodes JSON data from an HTTP request body into the provided 'data' object.
 // It ensures the JSON is properly formatted, validates its size, and handles various error scenarios.
 func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
 	// Check if the payload is of permitted size
-	maxBytes := 1024 * 1024 // 1 Mg
-	if t.MaxJSONSize != 0 {
-		maxBytes = t.MaxJSONSize
-	}
+	maxBytes := t.maxJSONBytes()
 
 	// Read request of the body
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 
+	// Decompress the body, the decompressed payload is limited as well
+	var body io.Reader
+	if r.Header.Get("Content-Encoding") != "" {
+		decoded, err := t.decodeBody(r, r.Body)
+		if err != nil {
+			return err
+		}
+		body = http.MaxBytesReader(w, io.NopCloser(decoded), int64(maxBytes))
+	} else {
+		body = r.Body
+	}
+
 	// Decode the body
-	decodedBody := json.NewDecoder(r.Body)
+	if t.MaxJSONDepth > 0 {
+		// Reject deeply nested payloads while they are being read
+		body = &depthLimitedReader{r: body, max: t.MaxJSONDepth}
+	}
+	decodedBody := json.NewDecoder(body)
 
 	// Check if we should process JSON with unknown fields
 	if !t.AllowUnknownFields {
 		decodedBody.DisallowUnknownFields()
 	}
 
+	// Keep numbers decoded into interface{} values as json.Number to avoid losing precision
+	if t.StrictNumbers {
+		decodedBody.UseNumber()
+	}
+
 	// Decode data
 	err := decodedBody.Decode(data)
 	if err != nil {
@@ -42,12 +72,18 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{
 		var unmarshalTypeError *json.UnmarshalTypeError
 		var invalidUnmarshalError *json.InvalidUnmarshalError
 		switch {
+		case errors.Is(err, errJSONTooDeep):
+			// If the payload is nested too deeply, report the limit
+			return fmt.Errorf("body must not be nested deeper than %d levels", t.MaxJSONDepth)
 		case errors.As(err, &syntaxError):
 			// If there's a syntax error in the JSON, report the position of the error
 			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
 		case errors.Is(err, io.ErrUnexpectedEOF):
 			// If the body is incomplete, return a malformed JSON error
 			return errors.New("body contains badly-formed JSON")
+		case t.StrictNumbers && errors.As(err, &unmarshalTypeError) && isIntegerOverflow(unmarshalTypeError):
+			// If an integer does not fit the target field, report the field
+			return fmt.Errorf("number out of range for field %q", unmarshalTypeError.Field)
 		case errors.As(err, &unmarshalTypeError):
 			// If there's a type mismatch, report which field is problematic
 			if unmarshalTypeError.Field != "" {
@@ -84,6 +120,146 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{
 	return nil
 }
 
+// maxJSONBytes returns the max size of a JSON payload, MaxJSONSize or 1MB by default
+func (t *Tools) maxJSONBytes() int {
+	if t.MaxJSONSize != 0 {
+		return t.MaxJSONSize
+	}
+	return 1024 * 1024 // 1 Mg
+}
+
+// JSONType is the kind of top-level value expected by ReadJSONExpectType
+type JSONType int
+
+const (
+	Object JSONType = iota + 1
+	Array
+)
+
+// String() returns the name of the JSON type as used in error messages
+func (j JSONType) String() string {
+	switch j {
+	case Object:
+		return "object"
+	case Array:
+		return "array"
+	}
+	return "value"
+}
+
+// jsonKind names the kind of JSON value that starts with the byte
+func jsonKind(b byte) string {
+	switch {
+	case b == '{':
+		return Object.String()
+	case b == '[':
+		return Array.String()
+	case b == '"':
+		return "string"
+	case b == 't' || b == 'f':
+		return "boolean"
+	case b == 'n':
+		return "null"
+	case b == '-' || (b >= '0' && b <= '9'):
+		return "number"
+	}
+	return "invalid JSON"
+}
+
+// ReadJSONExpectType works like ReadJSON, but first checks that the top-level value
+// of the payload is of the expected type, e.g. an array for batch endpoints.
+// A mismatch is reported as "expected JSON array, got object"
+func (t *Tools) ReadJSONExpectType(w http.ResponseWriter, r *http.Request, data interface{}, expected JSONType) error {
+	// Limit the body here already, the whitespace skipped below does not reach ReadJSON
+	r.Body = http.MaxBytesReader(w, r.Body, int64(t.maxJSONBytes()))
+	buffered := bufio.NewReader(r.Body)
+
+	// Skip insignificant whitespace and peek at the first byte of the value
+	for {
+		b, err := buffered.ReadByte()
+		if err != nil {
+			// Let ReadJSON report empty and oversized bodies
+			break
+		}
+		if b == ' ' || b == '\t' || b == '\n' || b == '\r' {
+			continue
+		}
+
+		buffered.UnreadByte()
+		if kind := jsonKind(b); kind != expected.String() {
+			return fmt.Errorf("expected JSON %s, got %s", expected, kind)
+		}
+		break
+	}
+
+	// Hand the buffered body to ReadJSON, closing the original body when done
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{buffered, r.Body}
+
+	return t.ReadJSON(w, r, data)
+}
+
+// errJSONTooDeep is returned by depthLimitedReader when the nesting limit is exceeded
+var errJSONTooDeep = errors.New("JSON nesting depth exceeded")
+
+// depthLimitedReader tracks the nesting depth of the JSON passing through it
+// and fails as soon as it exceeds max, before the decoder materializes the value
+type depthLimitedReader struct {
+	r        io.Reader
+	max      int
+	depth    int
+	inString bool // inside a string literal, where brackets do not count
+	escaped  bool // the previous character was a backslash inside a string
+}
+
+func (d *depthLimitedReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	for i, c := range p[:n] {
+		switch {
+		case d.escaped:
+			d.escaped = false
+		case d.inString && c == '\\':
+			d.escaped = true
+		case c == '"':
+			d.inString = !d.inString
+		case d.inString:
+		case c == '{' || c == '[':
+			if d.depth++; d.depth > d.max {
+				return i, errJSONTooDeep
+			}
+		case c == '}' || c == ']':
+			d.depth--
+		}
+	}
+	return n, err
+}
+
+// isIntegerOverflow reports whether the type error was caused by an integer
+// literal that does not fit the integer type of the target field
+func isIntegerOverflow(err *json.UnmarshalTypeError) bool {
+	if err.Type == nil {
+		return false
+	}
+
+	switch err.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return false
+	}
+
+	// The value is reported as "number <literal>"
+	literal, ok := strings.CutPrefix(err.Value, "number ")
+	if !ok {
+		return false
+	}
+
+	// Fractions and exponents are type errors rather than range errors
+	return !strings.ContainsAny(literal, ".eE")
+}
+
 // WriteJSON() writes a JSON response with provided status, data and an optional custom header
 func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, headers ...http.Header) error {
 	// Attempt to marshal the data into a pretty-printed JSON format
@@ -92,6 +268,22 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, h
 		return err
 	}
 
+	// Rename the top-level keys if a naming strategy was set
+	if t.JSONKeyTransform != nil {
+		if jsonData, err = t.transformJSONKeys(jsonData); err != nil {
+			return err
+		}
+	}
+
+	// Refuse to send a payload over the limit, nothing is written so the caller can respond with an error
+	if t.MaxResponseSize > 0 && len(jsonData) > t.MaxResponseSize {
+		err = fmt.Errorf("the JSON response of %d bytes exceeds the maximum size of %d bytes", len(jsonData), t.MaxResponseSize)
+		if t.ErrorLog != nil {
+			t.ErrorLog.Println(err) // Use provided logger
+		}
+		return err
+	}
+
 	// Check if a custom header should be set
 	if len(headers) > 0 {
 		for indx, hdr := range headers[0] {
@@ -99,8 +291,10 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, h
 		}
 	}
 
-	// Set Content-Type and provided status
+	// Set Content-Type, Content-Length and provided status
+	// The payload is fully buffered, so the length is known and the response is not chunked
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(jsonData)))
 	w.WriteHeader(status)
 
 	_, err = w.Write(jsonData)
@@ -114,6 +308,13 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, h
 
 // ErrorJSON() takes in an error and an optional status code, and sends a JSON error message
 func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error {
+	// An empty code is left out of the response
+	return t.ErrorJSONWithCode(w, err, "", status...)
+}
+
+// ErrorJSONWithCode() works like ErrorJSON, and adds a machine-readable code next to the
+// message, e.g. "email_taken", so that clients do not have to branch on the message
+func (t *Tools) ErrorJSONWithCode(w http.ResponseWriter, err error, code string, status ...int) error {
 	// Set a default status
 	statusCode := http.StatusBadRequest
 	if len(status) > 0 {
@@ -123,6 +324,174 @@ func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error
 	var JSONPayload JSONResponse
 	JSONPayload.Error = true
 	JSONPayload.Message = err.Error()
+	JSONPayload.Code = code
 
 	return t.WriteJSON(w, statusCode, JSONPayload)
 }
+
+// WriteJSONWrapped() works like WriteJSON, but nests the data under JSONDataKey,
+// for example {"data": ...}. The data is written bare when JSONDataKey is empty
+func (t *Tools) WriteJSONWrapped(w http.ResponseWriter, status int, data interface{}, headers ...http.Header) error {
+	if t.JSONDataKey != "" {
+		data = map[string]interface{}{t.JSONDataKey: data}
+	}
+	return t.WriteJSON(w, status, data, headers...)
+}
+
+// prefersMinimal reports whether the Prefer header of the request asks for return=minimal (RFC 7240)
+func prefersMinimal(r *http.Request) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			// Ignore parameters of the preference such as "; foo=bar"
+			token, _, _ := strings.Cut(preference, ";")
+			name, value, _ := strings.Cut(strings.TrimSpace(token), "=")
+			if strings.EqualFold(strings.TrimSpace(name), "return") && strings.EqualFold(strings.Trim(strings.TrimSpace(value), `"`), "minimal") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteJSONPrefer works like WriteJSON, but honors the Prefer: return=minimal request header:
+// the status is written with a Preference-Applied header and an empty body
+func (t *Tools) WriteJSONPrefer(w http.ResponseWriter, r *http.Request, status int, data interface{}, headers ...http.Header) error {
+	// The response depends on the Prefer header, so caches must keep the variants apart
+	w.Header().Add("Vary", "Prefer")
+
+	if !prefersMinimal(r) {
+		return t.WriteJSON(w, status, data, headers...)
+	}
+
+	// Check if a custom header should be set
+	if len(headers) > 0 {
+		for indx, hdr := range headers[0] {
+			w.Header()[indx] = hdr
+		}
+	}
+
+	w.Header().Set("Preference-Applied", "return=minimal")
+	w.WriteHeader(status)
+	return nil
+}
+
+// transformJSONKeys renames the top-level keys of a JSON object with JSONKeyTransform.
+// Other JSON values are returned as they are. The keys of the result are sorted
+func (t *Tools) transformJSONKeys(jsonData []byte) ([]byte, error) {
+	if trimmed := bytes.TrimSpace(jsonData); len(trimmed) == 0 || trimmed[0] != '{' {
+		return jsonData, nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(jsonData, &object); err != nil {
+		return nil, err
+	}
+
+	transformed := make(map[string]json.RawMessage, len(object))
+	for key, value := range object {
+		newKey := t.JSONKeyTransform(key)
+		if _, ok := transformed[newKey]; ok {
+			return nil, fmt.Errorf("JSON keys collide after transformation: %q", newKey)
+		}
+		transformed[newKey] = value
+	}
+
+	return json.MarshalIndent(transformed, "", "  ")
+}
+
+// WriteMultiStatus writes the per-item results of a batch operation
+// as a JSON array with the status 207 Multi-Status
+func (t *Tools) WriteMultiStatus(w http.ResponseWriter, results []ItemResult) error {
+	// Always send an array, even for an empty batch
+	if results == nil {
+		results = []ItemResult{}
+	}
+
+	return t.WriteJSON(w, http.StatusMultiStatus, results)
+}
+
+// RequireFields() checks that the named fields of a decoded struct were provided: pointers,
+// maps, slices and interfaces must not be nil, and other fields must not be zero. Fields are named
+// as in JSON, by their json tag or else their Go name. A pointer to a zero value counts as provided,
+// which tells an absent field apart from a zero one. Returns an error listing every missing field
+func (t *Tools) RequireFields(s interface{}, fields ...string) error {
+	v := reflect.ValueOf(s)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("RequireFields expects a struct, but received %T", s)
+	}
+
+	byName := make(map[string]reflect.Value)
+	collectJSONFields(v, byName)
+
+	var missing []string
+	for _, name := range fields {
+		field, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("the struct has no field %q", name)
+		}
+
+		switch field.Kind() {
+		case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+			if field.IsNil() {
+				missing = append(missing, name)
+			}
+		default:
+			if field.IsZero() {
+				missing = append(missing, name)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// collectJSONFields maps the JSON names of the exported fields of a struct to their values.
+// Fields of embedded structs are promoted, as encoding/json does, unless the outer struct
+// has a field of the same name
+func collectJSONFields(v reflect.Value, byName map[string]reflect.Value) {
+	var embedded []reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		// Embedded structs without a name of their own add their fields to the parent
+		if field.Anonymous && name == "" {
+			inner := v.Field(i)
+			if inner.Kind() == reflect.Pointer && !inner.IsNil() {
+				inner = inner.Elem()
+			}
+			if inner.Kind() == reflect.Struct {
+				embedded = append(embedded, inner)
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		byName[name] = v.Field(i)
+	}
+
+	for _, inner := range embedded {
+		promoted := make(map[string]reflect.Value)
+		collectJSONFields(inner, promoted)
+		for name, value := range promoted {
+			if _, ok := byName[name]; !ok {
+				byName[name] = value
+			}
+		}
+	}
+}
@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"unicode"
 )
 
 func TestTools_ReadJSON(t *testing.T) {
@@ -69,6 +73,43 @@ func TestTools_ReadJSON(t *testing.T) {
 	}
 }
 
+func TestTools_ReadJSON_StrictNumbers(t *testing.T) {
+	tests := []struct {
+		name          string
+		json          string
+		strict        bool
+		errorExpected string
+	}{
+		{"In range", `{"amount": 2147483647}`, true, ""},
+		{"Exceeds int32", `{"amount": 2147483648}`, true, `number out of range for field "amount"`},
+		{"Below int32", `{"amount": -2147483649}`, true, `number out of range for field "amount"`},
+		{"Fraction is a type error", `{"amount": 1.5}`, true, `body contains incorrect JSON type for field "amount"`},
+		{"Exceeds int32 without strict numbers", `{"amount": 2147483648}`, false, `body contains incorrect JSON type for field "amount"`},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{StrictNumbers: entry.strict}
+
+			var decodedJSON struct {
+				Amount int32 `json:"amount"`
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(entry.json))
+			resp := httptest.NewRecorder()
+
+			err := tools.ReadJSON(resp, req, &decodedJSON)
+
+			if entry.errorExpected == "" && err != nil {
+				t.Errorf("expected no error, but received %+v", err)
+			}
+
+			if entry.errorExpected != "" && (err == nil || err.Error() != entry.errorExpected) {
+				t.Errorf("expected error %s, but received %v", entry.errorExpected, err)
+			}
+		})
+	}
+}
+
 func TestTools_WriteJSON(t *testing.T) {
 	tests := []struct {
 		hdr   string
@@ -102,11 +143,60 @@ func TestTools_WriteJSON(t *testing.T) {
 			if setHeader != entry.value {
 				t.Errorf("expected to receive header %s, but received %s", entry.hdr, setHeader)
 			}
+
+			// Check that Content-Length matches the body size
+			contentLength := resp.Header().Get("Content-Length")
+			if contentLength != strconv.Itoa(resp.Body.Len()) {
+				t.Errorf("expected Content-Length %d, but received %s", resp.Body.Len(), contentLength)
+			}
 		})
 	}
 
 }
 
+func TestTools_WriteJSON_MaxResponseSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxSize       int
+		message       string
+		errorExpected bool
+	}{
+		{"Unlimited", 0, strings.Repeat("a", 1000), false},
+		{"Under the limit", 100, "foo", false},
+		{"Over the limit", 100, strings.Repeat("a", 1000), true},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var logged bytes.Buffer
+			tools := Tools{MaxResponseSize: entry.maxSize, ErrorLog: log.New(&logged, "", 0)}
+			resp := httptest.NewRecorder()
+
+			err := tools.WriteJSON(resp, http.StatusOK, JSONResponse{Message: entry.message})
+
+			if entry.errorExpected {
+				if err == nil {
+					t.Fatal("expected an error, but received none")
+				}
+				// Nothing is sent, so the caller can still respond with an error
+				if resp.Body.Len() != 0 {
+					t.Errorf("expected an empty body, but received %d bytes", resp.Body.Len())
+				}
+				if logged.Len() == 0 {
+					t.Error("expected the error to be logged")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("expected no error, but received %v", err)
+			}
+			if resp.Body.Len() == 0 {
+				t.Error("expected a body, but received none")
+			}
+		})
+	}
+}
+
 func TestTools_ErrorJSON(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -126,6 +216,10 @@ func TestTools_ErrorJSON(t *testing.T) {
 				t.Error(err)
 			}
 
+			if strings.Contains(resp.Body.String(), `"code"`) {
+				t.Errorf("expected no code in the response, but received %s", resp.Body.String())
+			}
+
 			// Check the response
 			var JSONPayload JSONResponse
 			decoder := json.NewDecoder(resp.Body)
@@ -146,3 +240,350 @@ func TestTools_ErrorJSON(t *testing.T) {
 	}
 
 }
+
+func TestTools_ErrorJSONWithCode(t *testing.T) {
+	tests := []struct {
+		name           string
+		code           string
+		status         []int
+		expectedStatus int
+	}{
+		{"Default status", "invalid_input", nil, http.StatusBadRequest},
+		{"Conflict", "email_taken", []int{http.StatusConflict}, http.StatusConflict},
+		{"Empty code", "", []int{http.StatusForbidden}, http.StatusForbidden},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			resp := httptest.NewRecorder()
+			err := tools.ErrorJSONWithCode(resp, errors.New("the email is already in use"), entry.code, entry.status...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var payload map[string]interface{}
+			if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+				t.Fatal("received error when decoding JSON:", err)
+			}
+
+			if payload["error"] != true {
+				t.Error("error set to false to JSON, but it should be set to true")
+			}
+			if payload["message"] != "the email is already in use" {
+				t.Errorf("expected the error message, but received %v", payload["message"])
+			}
+
+			code, ok := payload["code"]
+			if entry.code == "" && ok {
+				t.Errorf("expected no code, but received %v", code)
+			}
+			if entry.code != "" && code != entry.code {
+				t.Errorf("expected code %q, but received %v", entry.code, code)
+			}
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("expected status code %d, but received %d", entry.expectedStatus, resp.Code)
+			}
+		})
+	}
+}
+
+func TestTools_ReadJSON_MaxJSONDepth(t *testing.T) {
+	tests := []struct {
+		name          string
+		json          string
+		maxDepth      int
+		errorExpected bool
+	}{
+		{"Shallow payload", `{"foo":"bar"}`, 2, false},
+		{"At the limit", `{"foo":"bar","nested":{"a":[1]}}`, 3, false},
+		{"Past the limit", `{"foo":"bar","nested":{"a":[[1]]}}`, 3, true},
+		{"Brackets inside strings", `{"foo":"[[[{{{\"[["}`, 1, false},
+		{"Unlimited", `{"foo":"bar","nested":[[[[[[1]]]]]]}`, 0, false},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{MaxJSONDepth: entry.maxDepth, AllowUnknownFields: true}
+
+			var decodedJSON struct {
+				Foo string `json:"foo"`
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(entry.json))
+			resp := httptest.NewRecorder()
+
+			err := tools.ReadJSON(resp, req, &decodedJSON)
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but received none")
+			}
+
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %+v", err)
+			}
+		})
+	}
+}
+
+func TestTools_WriteMultiStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		results  []ItemResult
+		expected string
+	}{
+		{"Empty batch", nil, `[]`},
+		{"Mixed results", []ItemResult{
+			{ID: "1", Status: http.StatusCreated},
+			{ID: "2", Status: http.StatusConflict, Error: "already exists"},
+		}, `[{"id":"1","status":201},{"id":"2","status":409,"error":"already exists"}]`},
+	}
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+
+			if err := tools.WriteMultiStatus(resp, entry.results); err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			if resp.Code != http.StatusMultiStatus {
+				t.Errorf("expected status code %d, but received %d", http.StatusMultiStatus, resp.Code)
+			}
+
+			// Compact the indented body to compare the payload shape
+			var compacted bytes.Buffer
+			if err := json.Compact(&compacted, resp.Body.Bytes()); err != nil {
+				t.Fatal("received invalid JSON:", err)
+			}
+			if compacted.String() != entry.expected {
+				t.Errorf("expected body %s, but received %s", entry.expected, compacted.String())
+			}
+		})
+	}
+}
+
+func TestTools_ReadJSONExpectType(t *testing.T) {
+	tests := []struct {
+		name          string
+		json          string
+		expected      JSONType
+		errorExpected string
+	}{
+		{"Object expected and received", `{"foo": "bar"}`, Object, ""},
+		{"Array expected and received", `  [{"foo": "bar"}]`, Array, ""},
+		{"Array expected, object received", `{"foo": "bar"}`, Array, "expected JSON array, got object"},
+		{"Object expected, array received", "\n\t[{\"foo\": \"bar\"}]", Object, "expected JSON object, got array"},
+		{"Object expected, string received", `"foo"`, Object, "expected JSON object, got string"},
+		{"Empty body", "", Object, "body must not be empty"},
+	}
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(entry.json))
+			resp := httptest.NewRecorder()
+
+			var err error
+			if entry.expected == Array {
+				var decoded []struct {
+					Foo string `json:"foo"`
+				}
+				err = tools.ReadJSONExpectType(resp, req, &decoded, entry.expected)
+			} else {
+				var decoded struct {
+					Foo string `json:"foo"`
+				}
+				err = tools.ReadJSONExpectType(resp, req, &decoded, entry.expected)
+			}
+
+			if entry.errorExpected == "" && err != nil {
+				t.Errorf("expected no error, but received %v", err)
+			}
+
+			if entry.errorExpected != "" && (err == nil || err.Error() != entry.errorExpected) {
+				t.Errorf("expected error %q, but received %v", entry.errorExpected, err)
+			}
+		})
+	}
+}
+
+func TestTools_WriteJSONPrefer(t *testing.T) {
+	tests := []struct {
+		name            string
+		prefer          string
+		expectedBody    bool
+		expectedApplied string
+	}{
+		{"No preference", "", true, ""},
+		{"Minimal", "return=minimal", false, "return=minimal"},
+		{"Minimal among other preferences", "respond-async, RETURN=\"minimal\"; foo=bar", false, "return=minimal"},
+		{"Representation", "return=representation", true, ""},
+	}
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if entry.prefer != "" {
+				req.Header.Set("Prefer", entry.prefer)
+			}
+			resp := httptest.NewRecorder()
+
+			if err := tools.WriteJSONPrefer(resp, req, http.StatusCreated, JSONResponse{Message: "created"}); err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			if resp.Code != http.StatusCreated {
+				t.Errorf("expected status code %d, but received %d", http.StatusCreated, resp.Code)
+			}
+
+			if (resp.Body.Len() > 0) != entry.expectedBody {
+				t.Errorf("expected body %t, but received %q", entry.expectedBody, resp.Body.String())
+			}
+
+			if applied := resp.Header().Get("Preference-Applied"); applied != entry.expectedApplied {
+				t.Errorf("expected Preference-Applied %q, but received %q", entry.expectedApplied, applied)
+			}
+		})
+	}
+}
+
+// snakeCase converts camelCase keys such as "userId" to "user_id"
+func snakeCase(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func TestTools_WriteJSON_JSONKeyTransform(t *testing.T) {
+	type profile struct {
+		UserID    int    `json:"userId"`
+		FirstName string `json:"firstName"`
+		Nested    struct {
+			CreatedAt string `json:"createdAt"`
+		} `json:"nestedValue"`
+	}
+	var p profile
+	p.UserID, p.FirstName, p.Nested.CreatedAt = 7, "Ada", "today"
+
+	tests := []struct {
+		name      string
+		data      interface{}
+		transform func(string) string
+		expected  string
+	}{
+		{"Keys in snake_case", p, snakeCase, `{"first_name":"Ada","nested_value":{"createdAt":"today"},"user_id":7}`},
+		{"No transform", p, nil, `{"userId":7,"firstName":"Ada","nestedValue":{"createdAt":"today"}}`},
+		{"Arrays are left alone", []int{1, 2}, snakeCase, `[1,2]`},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{JSONKeyTransform: entry.transform}
+			resp := httptest.NewRecorder()
+
+			if err := tools.WriteJSON(resp, http.StatusOK, entry.data); err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			var compacted bytes.Buffer
+			if err := json.Compact(&compacted, resp.Body.Bytes()); err != nil {
+				t.Fatal("received invalid JSON:", err)
+			}
+			if compacted.String() != entry.expected {
+				t.Errorf("expected body %s, but received %s", entry.expected, compacted.String())
+			}
+
+			if resp.Header().Get("Content-Length") != strconv.Itoa(resp.Body.Len()) {
+				t.Errorf("expected Content-Length %d, but received %s", resp.Body.Len(), resp.Header().Get("Content-Length"))
+			}
+		})
+	}
+
+	// Keys that end up the same are reported
+	tools := Tools{JSONKeyTransform: strings.ToLower}
+	if err := tools.WriteJSON(httptest.NewRecorder(), http.StatusOK, map[string]int{"a": 1, "A": 2}); err == nil {
+		t.Error("expected an error for colliding keys, but received none")
+	}
+}
+
+func TestTools_WriteJSONWrapped(t *testing.T) {
+	payload := map[string]int{"id": 7}
+
+	tests := []struct {
+		name     string
+		key      string
+		expected string
+	}{
+		{"Data key", "data", `{"data":{"id":7}}`},
+		{"Result key", "result", `{"result":{"id":7}}`},
+		{"Empty key", "", `{"id":7}`},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{JSONDataKey: entry.key}
+			resp := httptest.NewRecorder()
+
+			if err := tools.WriteJSONWrapped(resp, http.StatusCreated, payload); err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			var compacted bytes.Buffer
+			if err := json.Compact(&compacted, resp.Body.Bytes()); err != nil {
+				t.Fatal("received invalid JSON:", err)
+			}
+			if compacted.String() != entry.expected {
+				t.Errorf("expected body %s, but received %s", entry.expected, compacted.String())
+			}
+			if resp.Code != http.StatusCreated {
+				t.Errorf("expected status %d, but received %d", http.StatusCreated, resp.Code)
+			}
+		})
+	}
+}
+
+func TestTools_RequireFields(t *testing.T) {
+	type Audit struct {
+		CreatedBy string `json:"createdBy"`
+	}
+	type payload struct {
+		Audit
+		Name    *string  `json:"name"`
+		Age     *int     `json:"age,omitempty"`
+		Tags    []string `json:"tags"`
+		Email   string
+		Ignored string `json:"-"`
+	}
+	name, zero := "Ada", 0
+
+	tests := []struct {
+		name          string
+		data          interface{}
+		fields        []string
+		errorExpected string
+	}{
+		{"All present", &payload{Name: &name, Age: &zero, Tags: []string{}, Email: "a@b.c", Audit: Audit{"admin"}}, []string{"name", "age", "tags", "Email", "createdBy"}, ""},
+		{"Pointer to zero value", payload{Age: &zero}, []string{"age"}, ""},
+		{"Several missing", &payload{Name: &name}, []string{"name", "age", "tags", "Email"}, "missing required fields: age, tags, Email"},
+		{"Embedded field missing", &payload{}, []string{"createdBy"}, "missing required fields: createdBy"},
+		{"Unknown field", &payload{}, []string{"Ignored"}, `the struct has no field "Ignored"`},
+		{"Not a struct", map[string]string{}, []string{"name"}, "RequireFields expects a struct, but received map[string]string"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			err := tools.RequireFields(entry.data, entry.fields...)
+			if entry.errorExpected == "" && err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+			if entry.errorExpected != "" && (err == nil || err.Error() != entry.errorExpected) {
+				t.Errorf("expected error %q, but received %v", entry.errorExpected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package toolkit
+
+import (
+	"golang.org/x/text/transform"
+)
+
+// LineEndingStyle is the line ending that NormalizeLineEndings converts text to
+type LineEndingStyle int
+
+const (
+	// LineEndingLF is the Unix line ending, \n
+	LineEndingLF LineEndingStyle = iota + 1
+	// LineEndingCRLF is the Windows line ending, \r\n
+	LineEndingCRLF
+	// LineEndingCR is the classic Mac OS line ending, \r
+	LineEndingCR
+)
+
+// bytes returns the line ending of the style, nil for an unknown style
+func (s LineEndingStyle) bytes() []byte {
+	switch s {
+	case LineEndingLF:
+		return []byte("\n")
+	case LineEndingCRLF:
+		return []byte("\r\n")
+	case LineEndingCR:
+		return []byte("\r")
+	}
+	return nil
+}
+
+// NormalizeLineEndings() converts every line ending of the text, \r\n, \n or \r, to the given
+// style. The text is returned unchanged for an unknown style
+func (t *Tools) NormalizeLineEndings(b []byte, style LineEndingStyle) []byte {
+	if style.bytes() == nil {
+		return b
+	}
+
+	normalized, _, err := transform.Bytes(lineEndingTransformer{ending: style.bytes()}, b)
+	if err != nil {
+		return b
+	}
+	return normalized
+}
+
+// lineEndingTransformer converts line endings while text is streamed, used for uploads
+type lineEndingTransformer struct {
+	transform.NopResetter
+	ending []byte
+}
+
+func (lt lineEndingTransformer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		c := src[nSrc]
+		if c != '\r' && c != '\n' {
+			if nDst >= len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst] = c
+			nDst++
+			nSrc++
+			continue
+		}
+
+		// A \r at the end of the chunk may be the first half of \r\n
+		consumed := 1
+		if c == '\r' {
+			if nSrc+1 == len(src) && !atEOF {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			if nSrc+1 < len(src) && src[nSrc+1] == '\n' {
+				consumed = 2
+			}
+		}
+
+		if nDst+len(lt.ending) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], lt.ending)
+		nSrc += consumed
+	}
+	return nDst, nSrc, nil
+}
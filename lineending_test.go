@@ -0,0 +1,56 @@
+package toolkit
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"golang.org/x/text/transform"
+)
+
+func TestTools_NormalizeLineEndings(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		style    LineEndingStyle
+		expected string
+	}{
+		{"CRLF to LF", "one\r\ntwo\r\nthree", LineEndingLF, "one\ntwo\nthree"},
+		{"LF to CRLF", "one\ntwo\nthree\n", LineEndingCRLF, "one\r\ntwo\r\nthree\r\n"},
+		{"Mixed to LF", "one\r\ntwo\nthree\rfour", LineEndingLF, "one\ntwo\nthree\nfour"},
+		{"Mixed to CR", "one\r\ntwo\nthree", LineEndingCR, "one\rtwo\rthree"},
+		{"CRLF stays CRLF", "one\r\ntwo", LineEndingCRLF, "one\r\ntwo"},
+		{"Blank lines", "\r\n\r\n\n\r", LineEndingLF, "\n\n\n\n"},
+		{"Trailing CR", "one\r", LineEndingLF, "one\n"},
+		{"Unknown style", "one\r\ntwo", 0, "one\r\ntwo"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			result := tools.NormalizeLineEndings([]byte(entry.input), entry.style)
+			if string(result) != entry.expected {
+				t.Errorf("expected %q, but received %q", entry.expected, result)
+			}
+		})
+	}
+
+	// Converting to LF and back restores the original
+	var tools Tools
+	original := []byte("a\r\nb\r\nc\r\n")
+	if roundTrip := tools.NormalizeLineEndings(tools.NormalizeLineEndings(original, LineEndingLF), LineEndingCRLF); !bytes.Equal(roundTrip, original) {
+		t.Errorf("expected %q, but received %q", original, roundTrip)
+	}
+}
+
+func TestLineEndingTransformer_SplitCRLF(t *testing.T) {
+	// One byte at a time, every \r\n is split across reads
+	reader := transform.NewReader(iotest.OneByteReader(bytes.NewReader([]byte("a\r\nb\r\n\rc"))), lineEndingTransformer{ending: []byte("\n")})
+	result, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal("expected no error, but received", err)
+	}
+	if string(result) != "a\nb\n\nc" {
+		t.Errorf("expected %q, but received %q", "a\nb\n\nc", result)
+	}
+}
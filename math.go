@@ -1,9 +1,133 @@
 package toolkit
 
-func (t *Tools) Sum(ints []int) int {
-	var sum int
-	for _, num := range ints {
+import (
+	"errors"
+	"sort"
+)
+
+// Number is the set of integer and floating point types the generic helpers work with
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Sum() calculates the sum of the numbers in the slice, or zero for an empty slice
+func Sum[T Number](nums []T) T {
+	var sum T
+	for _, num := range nums {
 		sum += num
 	}
 	return sum
 }
+
+// Sum() calculates the sum of the integers in the slice.
+// Kept for compatibility, see the generic Sum function for other numeric types
+func (t *Tools) Sum(ints []int) int {
+	return Sum(ints)
+}
+
+// errEmptySlice is returned by the aggregates that have no meaningful value for an empty slice
+var errEmptySlice = errors.New("cannot aggregate an empty slice")
+
+// Average() returns the arithmetic mean of the numbers in the slice.
+// Returns an error if the slice is empty
+func Average[T Number](nums []T) (float64, error) {
+	if len(nums) == 0 {
+		return 0, errEmptySlice
+	}
+
+	// Sum as float64, summing as T could overflow small integer types
+	var sum float64
+	for _, num := range nums {
+		sum += float64(num)
+	}
+	return sum / float64(len(nums)), nil
+}
+
+// Min() returns the smallest number in the slice. Returns an error if the slice is empty
+func Min[T Number](nums []T) (T, error) {
+	if len(nums) == 0 {
+		var zero T
+		return zero, errEmptySlice
+	}
+
+	lowest := nums[0]
+	for _, num := range nums[1:] {
+		if num < lowest {
+			lowest = num
+		}
+	}
+	return lowest, nil
+}
+
+// Max() returns the largest number in the slice. Returns an error if the slice is empty
+func Max[T Number](nums []T) (T, error) {
+	if len(nums) == 0 {
+		var zero T
+		return zero, errEmptySlice
+	}
+
+	highest := nums[0]
+	for _, num := range nums[1:] {
+		if num > highest {
+			highest = num
+		}
+	}
+	return highest, nil
+}
+
+// Median() returns the middle value of the slice, or the mean of the two middle values for
+// slices of even length. The slice is not modified. Returns an error if the slice is empty
+func (t *Tools) Median(nums []float64) (float64, error) {
+	if len(nums) == 0 {
+		return 0, errors.New("cannot compute the median of an empty slice")
+	}
+
+	// Sort a copy, the caller's slice keeps its order
+	sorted := make([]float64, len(nums))
+	copy(sorted, nums)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2, nil
+	}
+	return sorted[middle], nil
+}
+
+// Frequencies() counts how many times each number occurs in the slice
+func (t *Tools) Frequencies(nums []int) map[int]int {
+	freq := make(map[int]int, len(nums))
+	for _, num := range nums {
+		freq[num]++
+	}
+	return freq
+}
+
+// Mode() returns the most frequent value(s) in the slice and how many times they occur.
+// In case of a tie all modes are returned in ascending order.
+// Returns an error if the slice is empty
+func (t *Tools) Mode(nums []int) ([]int, int, error) {
+	if len(nums) == 0 {
+		return nil, 0, errors.New("cannot compute the mode of an empty slice")
+	}
+
+	var modes []int
+	var count int
+	for num, freq := range t.Frequencies(nums) {
+		switch {
+		case freq > count:
+			// A new most frequent value, start over
+			modes, count = []int{num}, freq
+		case freq == count:
+			// A tie, keep both values
+			modes = append(modes, num)
+		}
+	}
+
+	// Map iteration order is random, sort for a stable result
+	sort.Ints(modes)
+
+	return modes, count, nil
+}
@@ -1,6 +1,9 @@
 package toolkit
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 func Test_Sum(t *testing.T) {
 	var tools Tools
@@ -30,3 +33,219 @@ func Test_Sum(t *testing.T) {
 		})
 	}
 }
+
+func Test_Sum_Float64(t *testing.T) {
+	tests := []struct {
+		name     string
+		nums     []float64
+		expected float64
+	}{
+		{"Fractions", []float64{0.5, 1.25, 2.25}, 4},
+		{"Negative", []float64{-1.5, 2.5, -3}, -2},
+		{"Single", []float64{3.75}, 3.75},
+		{"Empty", []float64{}, 0},
+		{"Nil", nil, 0},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			result := Sum(entry.nums)
+
+			if result != entry.expected {
+				t.Errorf("expected %g, received %g", entry.expected, result)
+			}
+		})
+	}
+}
+
+func Test_Sum_Int64(t *testing.T) {
+	tests := []struct {
+		name     string
+		nums     []int64
+		expected int64
+	}{
+		{"Big ints", []int64{4_000_000_000, 5_000_000_000}, 9_000_000_000},
+		{"Negative", []int64{-4_000_000_000, 1, -2}, -4_000_000_001},
+		{"Empty", []int64{}, 0},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			result := Sum(entry.nums)
+
+			if result != entry.expected {
+				t.Errorf("expected %d, received %d", entry.expected, result)
+			}
+		})
+	}
+}
+
+func Test_Average(t *testing.T) {
+	tests := []struct {
+		name          string
+		nums          []int
+		expected      float64
+		errorExpected bool
+	}{
+		{"Whole mean", []int{1, 2, 3}, 2, false},
+		{"Fractional mean", []int{1, 2}, 1.5, false},
+		{"Negative", []int{-4, -2, 3}, -1, false},
+		{"Single element", []int{7}, 7, false},
+		{"Empty slice", []int{}, 0, true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			result, err := Average(entry.nums)
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but received none")
+			}
+
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %+v", err)
+			}
+
+			if result != entry.expected {
+				t.Errorf("expected %g, received %g", entry.expected, result)
+			}
+		})
+	}
+
+	// Small integer types do not overflow while summing
+	if avg, _ := Average([]int8{100, 100, 100}); avg != 100 {
+		t.Errorf("expected 100, received %g", avg)
+	}
+}
+
+func Test_MinMax(t *testing.T) {
+	tests := []struct {
+		name          string
+		nums          []float64
+		expectedMin   float64
+		expectedMax   float64
+		errorExpected bool
+	}{
+		{"Mixed", []float64{3.5, -1, 8, 2}, -1, 8, false},
+		{"All negative", []float64{-3, -1.5, -7}, -7, -1.5, false},
+		{"Single element", []float64{4.2}, 4.2, 4.2, false},
+		{"Empty slice", []float64{}, 0, 0, true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			lowest, minErr := Min(entry.nums)
+			highest, maxErr := Max(entry.nums)
+
+			if entry.errorExpected && (minErr == nil || maxErr == nil) {
+				t.Error("expected an error, but received none")
+			}
+
+			if !entry.errorExpected && (minErr != nil || maxErr != nil) {
+				t.Errorf("expected no error, but received %v and %v", minErr, maxErr)
+			}
+
+			if lowest != entry.expectedMin {
+				t.Errorf("expected min %g, received %g", entry.expectedMin, lowest)
+			}
+
+			if highest != entry.expectedMax {
+				t.Errorf("expected max %g, received %g", entry.expectedMax, highest)
+			}
+		})
+	}
+}
+
+func TestTools_Median(t *testing.T) {
+	var tools Tools
+	tests := []struct {
+		name          string
+		nums          []float64
+		expected      float64
+		errorExpected bool
+	}{
+		{"Odd length", []float64{1, 2, 3}, 2, false},
+		{"Even length", []float64{1, 2, 3, 4}, 2.5, false},
+		{"Unsorted", []float64{9, -1, 4.5, 3, 7}, 4.5, false},
+		{"Single element", []float64{6}, 6, false},
+		{"Empty slice", []float64{}, 0, true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			original := fmt.Sprint(entry.nums)
+			result, err := tools.Median(entry.nums)
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but received none")
+			}
+
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %+v", err)
+			}
+
+			if result != entry.expected {
+				t.Errorf("expected %g, received %g", entry.expected, result)
+			}
+
+			if fmt.Sprint(entry.nums) != original {
+				t.Errorf("expected the input to stay %s, received %v", original, entry.nums)
+			}
+		})
+	}
+}
+
+func TestTools_Mode(t *testing.T) {
+	var tools Tools
+	tests := []struct {
+		name          string
+		nums          []int
+		expectedModes []int
+		expectedCount int
+		errorExpected bool
+	}{
+		{"Unique mode", []int{1, 2, 2, 3}, []int{2}, 2, false},
+		{"Tie", []int{3, 1, 3, 1, 2}, []int{1, 3}, 2, false},
+		{"All distinct", []int{5, -1, 2}, []int{-1, 2, 5}, 1, false},
+		{"Single element", []int{7}, []int{7}, 1, false},
+		{"Empty slice", []int{}, nil, 0, true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			modes, count, err := tools.Mode(entry.nums)
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but received none")
+			}
+
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %+v", err)
+			}
+
+			if fmt.Sprint(modes) != fmt.Sprint(entry.expectedModes) {
+				t.Errorf("expected modes %v, received %v", entry.expectedModes, modes)
+			}
+
+			if count != entry.expectedCount {
+				t.Errorf("expected count %d, received %d", entry.expectedCount, count)
+			}
+		})
+	}
+}
+
+func TestTools_Frequencies(t *testing.T) {
+	var tools Tools
+	freq := tools.Frequencies([]int{1, 2, 2, 3, 3, 3})
+
+	expected := map[int]int{1: 1, 2: 2, 3: 3}
+	for num, count := range expected {
+		if freq[num] != count {
+			t.Errorf("expected %d to occur %d times, received %d", num, count, freq[num])
+		}
+	}
+
+	if len(freq) != len(expected) {
+		t.Errorf("expected %d entries, received %d", len(expected), len(freq))
+	}
+}
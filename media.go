@@ -0,0 +1,209 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// errUnknownDuration is returned when the container format is not supported
+var errUnknownDuration = errors.New("cannot determine media duration")
+
+// isMediaType reports whether the detected content type is audio or video
+func isMediaType(fileType string) bool {
+	return strings.HasPrefix(fileType, "audio/") || strings.HasPrefix(fileType, "video/")
+}
+
+// mediaDuration estimates the duration of an audio or video file.
+// MP4 durations are read from the movie header, MP3 durations from the
+// Xing/Info header when present, otherwise estimated from the bitrate
+// of the first frame, which is approximate for variable bitrate files.
+func mediaDuration(r io.ReaderAt, size int64) (time.Duration, error) {
+	head := make([]byte, 12)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	head = head[:n]
+
+	switch {
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		return mp4Duration(r, size)
+	case bytes.HasPrefix(head, []byte("ID3")), len(head) >= 2 && isMP3FrameSync(head[0], head[1]):
+		return mp3Duration(r, size)
+	}
+
+	return 0, errUnknownDuration
+}
+
+// mp4Duration walks the top level boxes to find moov/mvhd and reads the duration
+func mp4Duration(r io.ReaderAt, size int64) (time.Duration, error) {
+	moovStart, moovEnd, err := findMP4Box(r, 0, size, "moov")
+	if err != nil {
+		return 0, err
+	}
+
+	mvhdStart, _, err := findMP4Box(r, moovStart, moovEnd, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+
+	// The movie header starts with a version byte and three flag bytes
+	version := make([]byte, 1)
+	if _, err = r.ReadAt(version, mvhdStart); err != nil {
+		return 0, err
+	}
+
+	var timescale, duration uint64
+	if version[0] == 1 {
+		// 64-bit creation and modification times
+		buf := make([]byte, 12)
+		if _, err = r.ReadAt(buf, mvhdStart+4+16); err != nil {
+			return 0, err
+		}
+		timescale = uint64(binary.BigEndian.Uint32(buf[0:4]))
+		duration = binary.BigEndian.Uint64(buf[4:12])
+	} else {
+		// 32-bit creation and modification times
+		buf := make([]byte, 8)
+		if _, err = r.ReadAt(buf, mvhdStart+4+8); err != nil {
+			return 0, err
+		}
+		timescale = uint64(binary.BigEndian.Uint32(buf[0:4]))
+		duration = uint64(binary.BigEndian.Uint32(buf[4:8]))
+	}
+
+	if timescale == 0 {
+		return 0, errUnknownDuration
+	}
+
+	return seconds(float64(duration) / float64(timescale)), nil
+}
+
+// findMP4Box returns the content boundaries of the first box of the given type between start and end
+func findMP4Box(r io.ReaderAt, start, end int64, boxType string) (int64, int64, error) {
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return 0, 0, err
+		}
+
+		boxSize := int64(binary.BigEndian.Uint32(header[0:4]))
+		headerSize := int64(8)
+		switch boxSize {
+		case 0:
+			// The box extends to the end of the parent
+			boxSize = end - offset
+		case 1:
+			// The size is stored in the 64-bit largesize field
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return 0, 0, err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+
+		if boxSize < headerSize || offset+boxSize > end {
+			return 0, 0, errors.New("malformed MP4 box")
+		}
+
+		if string(header[4:8]) == boxType {
+			return offset + headerSize, offset + boxSize, nil
+		}
+
+		offset += boxSize
+	}
+
+	return 0, 0, errUnknownDuration
+}
+
+// MPEG audio layer III bitrates in kbps, indexed by the header bitrate index
+var (
+	mp3BitratesV1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3BitratesV2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	mp3SampleRate = [3]int{44100, 48000, 32000}
+)
+
+// isMP3FrameSync reports whether the two bytes start an MPEG audio layer III frame
+func isMP3FrameSync(b0, b1 byte) bool {
+	return b0 == 0xFF && b1&0xE0 == 0xE0 && (b1>>1)&0x03 == 0x01 && (b1>>3)&0x03 != 0x01
+}
+
+// mp3Duration finds the first frame and derives the duration from it
+func mp3Duration(r io.ReaderAt, size int64) (time.Duration, error) {
+	var offset int64
+
+	// Skip the ID3v2 tag, its size is stored as a 28-bit syncsafe integer
+	id3 := make([]byte, 10)
+	if n, _ := r.ReadAt(id3, 0); n == 10 && bytes.HasPrefix(id3, []byte("ID3")) {
+		tagSize := int64(id3[6])<<21 | int64(id3[7])<<14 | int64(id3[8])<<7 | int64(id3[9])
+		offset = 10 + tagSize
+		// A footer duplicates the header at the end of the tag
+		if id3[5]&0x10 != 0 {
+			offset += 10
+		}
+	}
+
+	// Look for the first frame header shortly after the tag
+	buf := make([]byte, 4096)
+	n, err := r.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		if !isMP3FrameSync(buf[i], buf[i+1]) {
+			continue
+		}
+
+		version := (buf[i+1] >> 3) & 0x03 // 3 = MPEG1, 2 = MPEG2, 0 = MPEG2.5
+		bitrateIndex := buf[i+2] >> 4
+		sampleIndex := (buf[i+2] >> 2) & 0x03
+		if sampleIndex == 3 || bitrateIndex == 0 || bitrateIndex == 15 {
+			continue
+		}
+
+		bitrate, sampleRate, samplesPerFrame := mp3BitratesV1[bitrateIndex], mp3SampleRate[sampleIndex], 1152
+		if version != 3 {
+			bitrate, sampleRate, samplesPerFrame = mp3BitratesV2[bitrateIndex], sampleRate/2, 576
+			if version == 0 {
+				sampleRate /= 2
+			}
+		}
+
+		// Variable bitrate files carry the number of frames in a Xing or Info header,
+		// placed right after the side information of the first frame
+		mono := buf[i+3]>>6 == 0x03
+		sideInfo := 32
+		switch {
+		case version == 3 && mono, version != 3 && !mono:
+			sideInfo = 17
+		case version != 3 && mono:
+			sideInfo = 9
+		}
+		xing := i + 4 + sideInfo
+		if xing+12 <= len(buf) {
+			tag := string(buf[xing : xing+4])
+			flags := binary.BigEndian.Uint32(buf[xing+4 : xing+8])
+			if (tag == "Xing" || tag == "Info") && flags&0x01 != 0 {
+				frames := int64(binary.BigEndian.Uint32(buf[xing+8 : xing+12]))
+				return seconds(float64(frames*int64(samplesPerFrame)) / float64(sampleRate)), nil
+			}
+		}
+
+		// Otherwise assume a constant bitrate
+		audioBytes := size - offset - int64(i)
+		return seconds(float64(audioBytes*8) / float64(bitrate*1000)), nil
+	}
+
+	return 0, errUnknownDuration
+}
+
+// seconds converts fractional seconds to a duration without overflowing on large files
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
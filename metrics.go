@@ -0,0 +1,136 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestKey groups the collected requests by method and status code
+type requestKey struct {
+	method string
+	code   int
+}
+
+// httpMetrics holds the values collected by the Metrics and InFlight middlewares
+type httpMetrics struct {
+	mu          sync.Mutex
+	requests    map[requestKey]uint64
+	durationSum float64
+	durationCnt uint64
+	inFlight    int64
+}
+
+// metricMethod returns the method label of a request. net/http accepts any token as a method,
+// so methods other than the standard ones are grouped under OTHER, clients cannot create series
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// metricsMu guards the lazy creation of the metrics of every Tools value
+var metricsMu sync.Mutex
+
+// httpMetrics returns the metrics of this Tools value, creating them on first use
+func (t *Tools) httpMetrics() *httpMetrics {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	if t.metrics == nil {
+		t.metrics = &httpMetrics{requests: make(map[requestKey]uint64)}
+	}
+	return t.metrics
+}
+
+// Metrics() is a middleware that counts requests by method and status code
+// and measures their duration, rendered by PrometheusHandler
+func (t *Tools) Metrics(next http.Handler) http.Handler {
+	metrics := t.httpMetrics()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		elapsed := time.Since(start).Seconds()
+
+		metrics.mu.Lock()
+		metrics.requests[requestKey{method: metricMethod(r.Method), code: sw.Status()}]++
+		metrics.durationSum += elapsed
+		metrics.durationCnt++
+		metrics.mu.Unlock()
+	})
+}
+
+// InFlight() is a middleware that tracks the number of requests currently being served,
+// rendered by PrometheusHandler
+func (t *Tools) InFlight(next http.Handler) http.Handler {
+	metrics := t.httpMetrics()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics.mu.Lock()
+		metrics.inFlight++
+		metrics.mu.Unlock()
+
+		defer func() {
+			metrics.mu.Lock()
+			metrics.inFlight--
+			metrics.mu.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// PrometheusHandler() returns a handler that renders the values collected by the Metrics
+// and InFlight middlewares in the Prometheus text exposition format
+func (t *Tools) PrometheusHandler() http.HandlerFunc {
+	metrics := t.httpMetrics()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		metrics.mu.Lock()
+		keys := make([]requestKey, 0, len(metrics.requests))
+		for key := range metrics.requests {
+			keys = append(keys, key)
+		}
+		// Render the series in a stable order
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].method != keys[j].method {
+				return keys[i].method < keys[j].method
+			}
+			return keys[i].code < keys[j].code
+		})
+
+		var b strings.Builder
+		b.WriteString("# HELP http_requests_total Total number of HTTP requests by method and status code.\n")
+		b.WriteString("# TYPE http_requests_total counter\n")
+		for _, key := range keys {
+			fmt.Fprintf(&b, "http_requests_total{method=\"%s\",code=\"%d\"} %d\n", escapeLabelValue(key.method), key.code, metrics.requests[key])
+		}
+
+		b.WriteString("# HELP http_request_duration_seconds Duration of HTTP requests in seconds.\n")
+		b.WriteString("# TYPE http_request_duration_seconds summary\n")
+		fmt.Fprintf(&b, "http_request_duration_seconds_sum %s\n", strconv.FormatFloat(metrics.durationSum, 'g', -1, 64))
+		fmt.Fprintf(&b, "http_request_duration_seconds_count %d\n", metrics.durationCnt)
+
+		b.WriteString("# HELP http_requests_in_flight Number of HTTP requests currently being served.\n")
+		b.WriteString("# TYPE http_requests_in_flight gauge\n")
+		fmt.Fprintf(&b, "http_requests_in_flight %d\n", metrics.inFlight)
+		metrics.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write([]byte(b.String()))
+	}
+}
+
+// escapeLabelValue escapes a label value as required by the text exposition format
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
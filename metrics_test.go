@@ -0,0 +1,106 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTools_PrometheusHandler(t *testing.T) {
+	tools := &Tools{}
+
+	// The handler reports the in-flight gauge while it is being served
+	var inFlight string
+	handler := tools.Metrics(tools.InFlight(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		scrape := httptest.NewRecorder()
+		tools.PrometheusHandler()(scrape, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		inFlight = metricValue(scrape.Body.String(), "http_requests_in_flight")
+	})))
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/"},
+		{http.MethodGet, "/"},
+		{http.MethodPost, "/"},
+		{http.MethodGet, "/missing"},
+	}
+	for _, req := range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	if inFlight != "1" {
+		t.Errorf("expected 1 request in flight while serving, but received %s", inFlight)
+	}
+
+	resp := httptest.NewRecorder()
+	tools.PrometheusHandler()(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	output := resp.Body.String()
+
+	tests := []struct {
+		name     string
+		metric   string
+		expected string
+	}{
+		{"Successful GET requests", `http_requests_total{method="GET",code="200"}`, "2"},
+		{"Successful POST requests", `http_requests_total{method="POST",code="200"}`, "1"},
+		{"Not found requests", `http_requests_total{method="GET",code="404"}`, "1"},
+		{"Duration count", "http_request_duration_seconds_count", "4"},
+		{"Nothing in flight", "http_requests_in_flight", "0"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			if value := metricValue(output, entry.metric); value != entry.expected {
+				t.Errorf("expected %s to be %s, but received %q in\n%s", entry.metric, entry.expected, value, output)
+			}
+		})
+	}
+
+	for _, metricType := range []string{"# TYPE http_requests_total counter", "# TYPE http_request_duration_seconds summary", "# TYPE http_requests_in_flight gauge"} {
+		if !strings.Contains(output, metricType) {
+			t.Errorf("expected the output to contain %q", metricType)
+		}
+	}
+}
+
+func TestTools_Metrics_UnknownMethods(t *testing.T) {
+	tools := &Tools{}
+	handler := tools.Metrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Made-up methods share one series, they cannot grow the metrics without bound
+	for i := 0; i < 100; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(fmt.Sprintf("METHOD%d", i), "/", nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/", nil))
+
+	resp := httptest.NewRecorder()
+	tools.PrometheusHandler()(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	output := resp.Body.String()
+
+	if value := metricValue(output, `http_requests_total{method="OTHER",code="200"}`); value != "100" {
+		t.Errorf("expected 100 requests with method OTHER, but received %q in\n%s", value, output)
+	}
+	if value := metricValue(output, `http_requests_total{method="DELETE",code="200"}`); value != "1" {
+		t.Errorf("expected 1 DELETE request, but received %q", value)
+	}
+	if series := strings.Count(output, "http_requests_total{"); series != 2 {
+		t.Errorf("expected 2 series, but received %d", series)
+	}
+}
+
+// metricValue returns the value of the series in the Prometheus text output
+func metricValue(output, series string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			return value
+		}
+	}
+	return ""
+}
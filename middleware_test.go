@@ -0,0 +1,828 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTools_RequireSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name            string
+		header          string
+		expectedStatus  int
+		expectedVersion string
+	}{
+		{"Supported version", "v1", http.StatusOK, "v1"},
+		{"Latest version", "v2", http.StatusOK, "v2"},
+		{"Missing header defaults to latest", "", http.StatusOK, "v2"},
+		{"Unsupported version", "v3", http.StatusBadRequest, ""},
+	}
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var version string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				version = tools.SchemaVersion(r)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if entry.header != "" {
+				req.Header.Set("X-Schema-Version", entry.header)
+			}
+			resp := httptest.NewRecorder()
+
+			tools.RequireSchemaVersion("v1", "v2")(next).ServeHTTP(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("expected status code %d, but received %d", entry.expectedStatus, resp.Code)
+			}
+
+			if version != entry.expectedVersion {
+				t.Errorf("expected version %q, but received %q", entry.expectedVersion, version)
+			}
+		})
+	}
+}
+
+func TestTools_RequireMinProto(t *testing.T) {
+	tests := []struct {
+		name           string
+		major          int
+		minor          int
+		expectedStatus int
+	}{
+		{"HTTP/1.0", 1, 0, http.StatusHTTPVersionNotSupported},
+		{"HTTP/1.1", 1, 1, http.StatusOK},
+		{"HTTP/2.0", 2, 0, http.StatusOK},
+	}
+	var tools Tools
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.ProtoMajor, req.ProtoMinor = entry.major, entry.minor
+			resp := httptest.NewRecorder()
+
+			tools.RequireMinProto(1, 1)(next).ServeHTTP(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("expected status code %d, but received %d", entry.expectedStatus, resp.Code)
+			}
+		})
+	}
+}
+
+func TestTools_Hostname(t *testing.T) {
+	tests := []struct {
+		name           string
+		host           string
+		forwardedHost  string
+		trustForwarded bool
+		expected       string
+	}{
+		{"Plain host", "example.com", "", false, "example.com"},
+		{"Strip port", "example.com:8080", "", false, "example.com"},
+		{"Lowercase", "EXAMPLE.com", "", false, "example.com"},
+		{"Trailing dot", "example.com.", "", false, "example.com"},
+		{"IPv6 with port", "[::1]:8080", "", false, "::1"},
+		{"Forwarded host is ignored", "example.com", "evil.com", false, "example.com"},
+		{"Trusted forwarded host", "internal:8080", "API.example.com:443, proxy", true, "api.example.com"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{TrustForwardedHost: entry.trustForwarded}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = entry.host
+			if entry.forwardedHost != "" {
+				req.Header.Set("X-Forwarded-Host", entry.forwardedHost)
+			}
+
+			if result := tools.Hostname(req); result != entry.expected {
+				t.Errorf("expected %s, but received %s", entry.expected, result)
+			}
+		})
+	}
+}
+
+func TestTools_ValidateHost(t *testing.T) {
+	tests := []struct {
+		name          string
+		host          string
+		errorExpected bool
+	}{
+		{"Allowed host", "example.com", false},
+		{"Allowed host with port", "Example.com:8080", false},
+		{"Unknown host", "evil.com", true},
+	}
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = entry.host
+
+			err := tools.ValidateHost(req, []string{"example.com", "api.example.com"})
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but received none")
+			}
+
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %+v", err)
+			}
+		})
+	}
+}
+
+func TestTools_LimitConcurrentPerIP(t *testing.T) {
+	var tools Tools
+	const max = 2
+
+	// Requests to /slow block until released, other requests return right away
+	started, release := make(chan struct{}), make(chan struct{})
+	limited := tools.LimitConcurrentPerIP(max)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+	}))
+
+	serve := func(ip, path string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		resp := httptest.NewRecorder()
+		limited.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	// Fill all the slots of one client
+	var wg sync.WaitGroup
+	codes := make([]int, max)
+	for i := 0; i < max; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = serve("10.0.0.1", "/slow")
+		}(i)
+		<-started
+	}
+
+	// The extra request from the same client is rejected
+	if code := serve("10.0.0.1", "/fast"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status code %d, but received %d", http.StatusTooManyRequests, code)
+	}
+
+	// Another client is not affected
+	if code := serve("10.0.0.2", "/fast"); code != http.StatusOK {
+		t.Errorf("expected status code %d, but received %d", http.StatusOK, code)
+	}
+
+	// Finish the in-flight requests, the slots are released afterwards
+	close(release)
+	wg.Wait()
+	for _, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("expected status code %d, but received %d", http.StatusOK, code)
+		}
+	}
+
+	if code := serve("10.0.0.1", "/fast"); code != http.StatusOK {
+		t.Errorf("expected status code %d after release, but received %d", http.StatusOK, code)
+	}
+}
+
+func TestTools_RequireUpgrade(t *testing.T) {
+	tests := []struct {
+		name           string
+		connection     string
+		upgrade        string
+		expectedStatus int
+	}{
+		{"Plain request", "", "", http.StatusUpgradeRequired},
+		{"Upgrade header only", "", "websocket", http.StatusUpgradeRequired},
+		{"Wrong protocol", "Upgrade", "h2c", http.StatusUpgradeRequired},
+		{"WebSocket upgrade", "Upgrade", "websocket", http.StatusOK},
+		{"Multiple connection tokens", "keep-alive, Upgrade", "WebSocket", http.StatusOK},
+	}
+	var tools Tools
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			if entry.connection != "" {
+				req.Header.Set("Connection", entry.connection)
+			}
+			if entry.upgrade != "" {
+				req.Header.Set("Upgrade", entry.upgrade)
+			}
+			resp := httptest.NewRecorder()
+
+			tools.RequireUpgrade("websocket")(next).ServeHTTP(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("expected status code %d, but received %d", entry.expectedStatus, resp.Code)
+			}
+
+			if entry.expectedStatus == http.StatusUpgradeRequired && resp.Header().Get("Upgrade") != "websocket" {
+				t.Errorf("expected Upgrade header websocket, but received %s", resp.Header().Get("Upgrade"))
+			}
+		})
+	}
+}
+
+func TestTools_CustomLoggers(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("something broke")
+	})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name       string
+		middleware func(tools *Tools) http.Handler
+		useInfoLog bool
+		expected   string
+	}{
+		{"LogRequest uses InfoLog", func(tools *Tools) http.Handler { return tools.LogRequest(ok) }, true, "GET /logged"},
+		{"RecoverPanic uses ErrorLog", func(tools *Tools) http.Handler { return tools.RecoverPanic(panicking) }, false, "something broke"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var custom, fallback bytes.Buffer
+			// Capture the standard logger to check that it is not used
+			log.SetOutput(&fallback)
+			defer log.SetOutput(os.Stderr)
+
+			tools := &Tools{}
+			if entry.useInfoLog {
+				tools.InfoLog = log.New(&custom, "INFO\t", 0)
+			} else {
+				tools.ErrorLog = log.New(&custom, "ERROR\t", 0)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/logged", nil)
+			entry.middleware(tools).ServeHTTP(httptest.NewRecorder(), req)
+
+			if !strings.Contains(custom.String(), entry.expected) {
+				t.Errorf("expected the custom logger to receive %q, but received %q", entry.expected, custom.String())
+			}
+
+			if fallback.Len() != 0 {
+				t.Errorf("expected the standard logger to be unused, but received %q", fallback.String())
+			}
+
+			// Without custom loggers the standard logger is used
+			custom.Reset()
+			entry.middleware(&Tools{}).ServeHTTP(httptest.NewRecorder(), req)
+
+			if !strings.Contains(fallback.String(), entry.expected) {
+				t.Errorf("expected the standard logger to receive %q, but received %q", entry.expected, fallback.String())
+			}
+		})
+	}
+}
+
+func TestTools_RejectSmuggling(t *testing.T) {
+	// Requests built by hand, like an adapter for another front end would build them
+	tests := []struct {
+		name             string
+		contentLength    []string
+		transferEncoding string
+		expectedStatus   int
+	}{
+		{"Normal request", []string{"5"}, "", http.StatusOK},
+		{"Chunked request", nil, "chunked", http.StatusOK},
+		{"Content-Length and Transfer-Encoding", []string{"5"}, "chunked", http.StatusBadRequest},
+		{"Conflicting Content-Length headers", []string{"5", "6"}, "", http.StatusBadRequest},
+		{"Duplicate Content-Length headers", []string{"5", "5"}, "", http.StatusBadRequest},
+		{"Comma-joined Content-Length", []string{"5, 6"}, "", http.StatusBadRequest},
+	}
+	var tools Tools
+	handler := tools.RejectSmuggling(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello"))
+			for _, length := range entry.contentLength {
+				req.Header.Add("Content-Length", length)
+			}
+			if entry.transferEncoding != "" {
+				req.Header.Set("Transfer-Encoding", entry.transferEncoding)
+			}
+			resp := httptest.NewRecorder()
+
+			handler.ServeHTTP(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("expected status code %d, but received %d", entry.expectedStatus, resp.Code)
+			}
+		})
+	}
+}
+
+func TestTools_RejectSmuggling_NetHTTP(t *testing.T) {
+	var tools Tools
+	server := httptest.NewServer(tools.RejectSmuggling(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("X-Handled", "true")
+	})))
+	defer server.Close()
+
+	// net/http deals with ambiguous framing itself, the middleware never sees it
+	tests := []struct {
+		name           string
+		headers        string
+		body           string
+		expectedStatus int
+		handled        bool
+	}{
+		{"Normal request", "Content-Length: 5\r\n", "hello", http.StatusOK, true},
+		{"Content-Length is dropped from chunked requests", "Content-Length: 5\r\nTransfer-Encoding: chunked\r\n", "5\r\nhello\r\n0\r\n\r\n", http.StatusOK, true},
+		{"Identical Content-Length headers are merged", "Content-Length: 5\r\nContent-Length: 5\r\n", "hello", http.StatusOK, true},
+		{"Conflicting Content-Length headers are rejected", "Content-Length: 5\r\nContent-Length: 6\r\n", "hello!", http.StatusBadRequest, false},
+		{"Comma-joined Content-Length is rejected", "Content-Length: 5, 6\r\n", "hello", http.StatusBadRequest, false},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", server.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: example.com\r\n%s\r\n%s", entry.headers, entry.body)
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != entry.expectedStatus {
+				t.Errorf("expected status code %d, but received %d", entry.expectedStatus, resp.StatusCode)
+			}
+			if handled := resp.Header.Get("X-Handled") == "true"; handled != entry.handled {
+				t.Errorf("expected the handler to run to be %t", entry.handled)
+			}
+		})
+	}
+}
+
+// tricklingReader returns one byte per read after a delay, like a slow client
+type tricklingReader struct {
+	remaining int
+	delay     time.Duration
+}
+
+func (tr *tricklingReader) Read(p []byte) (int, error) {
+	if tr.remaining == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(tr.delay)
+	tr.remaining--
+	p[0] = 'x'
+	return 1, nil
+}
+
+func TestTools_SlowBody(t *testing.T) {
+	defer func(window time.Duration) { slowBodyWindow = window }(slowBodyWindow)
+	slowBodyWindow = 50 * time.Millisecond
+
+	tests := []struct {
+		name          string
+		body          io.Reader
+		errorExpected bool
+	}{
+		{"Fast client", bytes.NewReader(make([]byte, 64*1024)), false},
+		{"Slow client", &tricklingReader{remaining: 20, delay: 10 * time.Millisecond}, true},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			var readErr error
+			handler := tools.SlowBody(1024, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, readErr = io.ReadAll(r.Body)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", entry.body)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if entry.errorExpected && readErr != errSlowBody {
+				t.Errorf("expected %v, but received %v", errSlowBody, readErr)
+			}
+			if !entry.errorExpected && readErr != nil {
+				t.Error("expected no error, but received", readErr)
+			}
+		})
+	}
+}
+
+func TestTools_SlowBody_StalledClient(t *testing.T) {
+	defer func(window time.Duration) { slowBodyWindow = window }(slowBodyWindow)
+	slowBodyWindow = 50 * time.Millisecond
+
+	var tools Tools
+	readErr := make(chan error, 1)
+	srv := httptest.NewServer(tools.SlowBody(1024, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		readErr <- err
+	})))
+	defer srv.Close()
+
+	// Announce a body and then stop sending
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 100\r\n\r\nx")
+
+	select {
+	case err := <-readErr:
+		if err != errSlowBody {
+			t.Errorf("expected %v, but received %v", errSlowBody, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the stalled read to be cut off")
+	}
+}
+
+func TestTools_GetClientIP_TrustedProxies(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"Trusted proxy", []string{"10.0.0.0/8"}, "10.1.2.3:4000", "203.0.113.7", "203.0.113.7"},
+		{"Untrusted source spoofing", []string{"10.0.0.0/8"}, "198.51.100.9:4000", "203.0.113.7", "198.51.100.9"},
+		{"Spoofed entry before the proxy", []string{"10.0.0.0/8"}, "10.1.2.3:4000", "1.1.1.1, 203.0.113.7", "203.0.113.7"},
+		{"Chain of trusted proxies", []string{"10.0.0.0/8", "192.168.1.1"}, "10.1.2.3:4000", "203.0.113.7, 192.168.1.1, 10.9.9.9", "203.0.113.7"},
+		{"Trusted proxy without header", []string{"10.0.0.0/8"}, "10.1.2.3:4000", "", "10.1.2.3"},
+		{"IPv6 proxy", []string{"2001:db8::/32"}, "[2001:db8::1]:4000", "203.0.113.7", "203.0.113.7"},
+		{"Invalid entries are ignored", []string{"not-a-cidr"}, "10.1.2.3:4000", "203.0.113.7", "10.1.2.3"},
+		{"No trusted proxies", nil, "10.1.2.3:4000", "203.0.113.7, 10.1.2.3", "203.0.113.7"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{TrustedProxies: entry.proxies, ErrorLog: log.New(io.Discard, "", 0)}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = entry.remoteAddr
+			if entry.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", entry.forwarded)
+			}
+
+			// Ask twice, the second call uses the parsed proxies
+			for i := 0; i < 2; i++ {
+				if ip := tools.GetClientIP(req); ip != entry.expected {
+					t.Errorf("expected %s, but received %s", entry.expected, ip)
+				}
+			}
+		})
+	}
+}
+
+func TestTools_BodyLimitByContentType(t *testing.T) {
+	limits := map[string]int64{
+		"application/json": 100,
+		"multipart/*":      10_000,
+		"*":                50,
+	}
+
+	tests := []struct {
+		name          string
+		contentType   string
+		size          int
+		limits        map[string]int64
+		errorExpected bool
+	}{
+		{"JSON within limit", "application/json", 100, limits, false},
+		{"JSON over limit", "application/json; charset=utf-8", 500, limits, true},
+		{"Multipart gets the large limit", "multipart/form-data; boundary=xyz", 500, limits, false},
+		{"Multipart over limit", "multipart/form-data; boundary=xyz", 20_000, limits, true},
+		{"Default limit", "text/plain", 60, limits, true},
+		{"Missing content type uses default", "", 60, limits, true},
+		{"No matching limit", "text/plain", 60, map[string]int64{"application/json": 100}, false},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			var readErr error
+			handler := tools.BodyLimitByContentType(entry.limits)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, readErr = io.ReadAll(r.Body)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(make([]byte, entry.size)))
+			if entry.contentType != "" {
+				req.Header.Set("Content-Type", entry.contentType)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			var maxBytesErr *http.MaxBytesError
+			if entry.errorExpected && !errors.As(readErr, &maxBytesErr) {
+				t.Errorf("expected a MaxBytesError, but received %v", readErr)
+			}
+			if !entry.errorExpected && readErr != nil {
+				t.Error("expected no error, but received", readErr)
+			}
+		})
+	}
+}
+
+func TestTools_Timeout(t *testing.T) {
+	tests := []struct {
+		name           string
+		work           time.Duration
+		expectedStatus int
+		expectedErr    error
+	}{
+		{"Fast handler", 0, http.StatusCreated, nil},
+		{"Slow handler", time.Second, http.StatusServiceUnavailable, context.DeadlineExceeded},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			ctxErr := make(chan error, 1)
+			handler := tools.Timeout(50 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(entry.work):
+					w.WriteHeader(http.StatusCreated)
+				case <-r.Context().Done():
+				}
+				ctxErr <- r.Context().Err()
+			}))
+
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("expected status %d, but received %d", entry.expectedStatus, resp.Code)
+			}
+			// The handler sees the cancellation through the request context
+			if err := <-ctxErr; err != entry.expectedErr {
+				t.Errorf("expected context error %v, but received %v", entry.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestTools_Compress(t *testing.T) {
+	text := strings.Repeat("compress me please ", 50)
+
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		handler          http.HandlerFunc
+		expectCompressed bool
+	}{
+		{
+			name:             "Gzip client",
+			acceptEncoding:   "gzip, deflate, br",
+			handler:          func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, text) },
+			expectCompressed: true,
+		},
+		{
+			name:             "No Accept-Encoding",
+			acceptEncoding:   "",
+			handler:          func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, text) },
+			expectCompressed: false,
+		},
+		{
+			name:             "Gzip refused",
+			acceptEncoding:   "gzip;q=0, *",
+			handler:          func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, text) },
+			expectCompressed: false,
+		},
+		{
+			name:             "Wildcard",
+			acceptEncoding:   "*",
+			handler:          func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, text) },
+			expectCompressed: true,
+		},
+		{
+			name:           "JSON with Content-Length",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				var tools Tools
+				tools.WriteJSON(w, http.StatusOK, map[string]string{"message": text})
+			},
+			expectCompressed: true,
+		},
+		{
+			name:           "Already compressed type",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				io.WriteString(w, text)
+			},
+			expectCompressed: false,
+		},
+		{
+			name:           "Already encoded",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "br")
+				io.WriteString(w, text)
+			},
+			expectCompressed: false,
+		},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			srv := httptest.NewServer(tools.Compress(entry.handler))
+			defer srv.Close()
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if entry.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", entry.acceptEncoding)
+			}
+			// Setting Accept-Encoding ourselves keeps the transport from decompressing
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			compressed := resp.Header.Get("Content-Encoding") == "gzip"
+			if compressed != entry.expectCompressed {
+				t.Fatalf("expected compressed to be %t, but received Content-Encoding %q", entry.expectCompressed, resp.Header.Get("Content-Encoding"))
+			}
+			if compressed {
+				gz, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatal("expected a gzip body, but received", err)
+				}
+				if body, err = io.ReadAll(gz); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if !strings.Contains(string(body), "compress me please") {
+				t.Errorf("expected the original content, but received %q", body)
+			}
+			if resp.Header.Get("Vary") != "Accept-Encoding" {
+				t.Errorf("expected Vary: Accept-Encoding, but received %q", resp.Header.Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestTools_Compress_FlushBeforeWrite(t *testing.T) {
+	var tools Tools
+	server := httptest.NewServer(tools.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The usual event stream: headers, flush, then events
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+	})))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Setting the header stops the transport from decompressing the body itself
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "gzip" {
+		t.Fatalf("expected Content-Encoding gzip, but received %q", encoding)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "data: hello\n\n" {
+		t.Errorf("expected the event, but received %q", body)
+	}
+}
+
+func TestTools_LogRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		expected string
+	}{
+		{"Explicit status", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+			io.WriteString(w, "short and stout")
+		}, "HTTP/1.1 POST /brew?size=large - 418 15 bytes in "},
+		{"Implicit status", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "ok")
+		}, "HTTP/1.1 POST /brew?size=large - 200 2 bytes in "},
+		{"No response body", func(w http.ResponseWriter, r *http.Request) {}, "HTTP/1.1 POST /brew?size=large - 200 0 bytes in "},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var logged bytes.Buffer
+			tools := Tools{InfoLog: log.New(&logged, "", 0)}
+
+			req := httptest.NewRequest(http.MethodPost, "/brew?size=large", nil)
+			tools.LogRequest(entry.handler).ServeHTTP(httptest.NewRecorder(), req)
+
+			if !strings.Contains(logged.String(), entry.expected) {
+				t.Errorf("expected the log to contain %q, but received %q", entry.expected, logged.String())
+			}
+		})
+	}
+}
+
+func TestTools_WrappedWritersFlush(t *testing.T) {
+	tools := Tools{InfoLog: log.New(io.Discard, "", 0)}
+	tests := []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+	}{
+		{"LogRequest", tools.LogRequest},
+		{"Metrics", tools.Metrics},
+		{"Idempotency", tools.Idempotency(NewMemoryIdempotencyStore())},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			handler := entry.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				flusher, ok := w.(http.Flusher)
+				if !ok {
+					t.Fatal("expected the writer to implement http.Flusher")
+				}
+				io.WriteString(w, "data: hello\n\n")
+				flusher.Flush()
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/events", nil)
+			req.Header.Set("Idempotency-Key", "abc")
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+
+			if !resp.Flushed {
+				t.Error("expected the response to be flushed")
+			}
+		})
+	}
+}
+
+func TestTools_BasicAuth(t *testing.T) {
+	tests := []struct {
+		name           string
+		setAuth        bool
+		username       string
+		password       string
+		expectedStatus int
+	}{
+		{"Correct credentials", true, "admin", "s3cret", http.StatusOK},
+		{"Wrong password", true, "admin", "guess", http.StatusUnauthorized},
+		{"Wrong username", true, "root", "s3cret", http.StatusUnauthorized},
+		{"Empty credentials", true, "", "", http.StatusUnauthorized},
+		{"Missing header", false, "", "", http.StatusUnauthorized},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			handler := tools.BasicAuth("admin", "s3cret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if entry.setAuth {
+				req.SetBasicAuth(entry.username, entry.password)
+			}
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("expected status %d, but received %d", entry.expectedStatus, resp.Code)
+			}
+
+			challenge := resp.Header().Get("WWW-Authenticate")
+			if entry.expectedStatus == http.StatusUnauthorized && !strings.HasPrefix(challenge, "Basic realm=") {
+				t.Errorf("expected a Basic challenge, but received %q", challenge)
+			}
+			if entry.expectedStatus == http.StatusOK && challenge != "" {
+				t.Errorf("expected no challenge, but received %q", challenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package toolkit
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// acceptRange is a single entry of an Accept-style header with its quality value
+type acceptRange struct {
+	value string
+	q     float64
+}
+
+// parseAccept splits an Accept-style header into its values and quality values.
+// Entries without a q parameter default to 1, malformed q values count as 0
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(strings.TrimSpace(key), "q") {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+				if err != nil || parsed < 0 || parsed > 1 {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+
+		ranges = append(ranges, acceptRange{value: value, q: q})
+	}
+	return ranges
+}
+
+// mediaTypeSpecificity returns how specifically the accepted range matches the offer:
+// 3 for an exact match, 2 for type/*, 1 for */* and 0 if it does not match
+func mediaTypeSpecificity(accepted, offer string) int {
+	switch {
+	case accepted == offer:
+		return 3
+	case accepted == "*/*":
+		return 1
+	case strings.HasSuffix(accepted, "/*"):
+		acceptedType, _, _ := strings.Cut(accepted, "/")
+		offerType, _, _ := strings.Cut(offer, "/")
+		if acceptedType == offerType {
+			return 2
+		}
+	}
+	return 0
+}
+
+// NegotiateContentType() returns the offer that best matches the Accept header of the request.
+// Quality values are respected and the most specific matching range decides the quality of an offer,
+// ties are resolved in favour of the earlier offer. Defaults to the first offer when the header
+// is missing or nothing matches
+func (t *Tools) NegotiateContentType(r *http.Request, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+
+	ranges := parseAccept(r.Header.Get("Accept"))
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		normalized := strings.ToLower(offer)
+
+		// The most specific matching range decides the quality of the offer
+		specificity, q := 0, 0.0
+		for _, ar := range ranges {
+			if s := mediaTypeSpecificity(ar.value, normalized); s > specificity {
+				specificity, q = s, ar.q
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+// defaultCharset is returned by NegotiateCharset when nothing better can be chosen
+const defaultCharset = "utf-8"
+
+// NegotiateCharset() returns the supported charset that best matches the Accept-Charset header
+// of the request. Quality values are respected, an explicitly listed charset takes precedence
+// over the * wildcard, and ties are resolved in favour of the earlier supported charset.
+// Defaults to UTF-8 when the header is missing or nothing matches
+func (t *Tools) NegotiateCharset(r *http.Request, supported []string) string {
+	ranges := parseAccept(r.Header.Get("Accept-Charset"))
+	if len(ranges) == 0 {
+		return defaultCharset
+	}
+
+	best, bestQ := defaultCharset, 0.0
+	for _, charset := range supported {
+		normalized := strings.ToLower(charset)
+
+		// An explicit entry decides the quality, the wildcard only applies otherwise
+		matched, q := false, 0.0
+		for _, ar := range ranges {
+			if ar.value == normalized {
+				matched, q = true, ar.q
+				break
+			}
+			if ar.value == "*" && !matched {
+				q = ar.q
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = charset, q
+		}
+	}
+
+	return best
+}
+
+// negotiatedTypes are the formats WriteNegotiated can produce, JSON first so it wins ties
+var negotiatedTypes = []string{"application/json", "application/xml", "text/xml"}
+
+// WriteNegotiated() writes data as XML or JSON, whichever the Accept header of the request prefers.
+// Quality values are respected and JSON is written when the header is missing or matches neither
+func (t *Tools) WriteNegotiated(w http.ResponseWriter, r *http.Request, status int, data interface{}) error {
+	// The response depends on the Accept header, tell caches about it
+	w.Header().Add("Vary", "Accept")
+
+	if t.NegotiateContentType(r, negotiatedTypes) == "application/json" {
+		return t.WriteJSON(w, status, data)
+	}
+	return t.WriteXML(w, status, data)
+}
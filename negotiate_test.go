@@ -0,0 +1,111 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTools_NegotiateContentType(t *testing.T) {
+	offers := []string{"application/json", "application/xml", "text/html"}
+	tests := []struct {
+		name     string
+		accept   string
+		expected string
+	}{
+		{"Missing header", "", "application/json"},
+		{"Exact match", "application/xml", "application/xml"},
+		{"Q-value ordering", "application/json;q=0.5, application/xml;q=0.9", "application/xml"},
+		{"Any type", "*/*", "application/json"},
+		{"Type wildcard", "text/*", "text/html"},
+		{"Specific range overrides wildcard", "application/*;q=0.8, application/json;q=0.1", "application/xml"},
+		{"Excluded offer", "application/json;q=0, */*;q=0.5", "application/xml"},
+		{"No match defaults to first offer", "image/png", "application/json"},
+		{"Case insensitive", "Application/XML", "application/xml"},
+	}
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if entry.accept != "" {
+				req.Header.Set("Accept", entry.accept)
+			}
+
+			if result := tools.NegotiateContentType(req, offers); result != entry.expected {
+				t.Errorf("expected %s, but received %s", entry.expected, result)
+			}
+		})
+	}
+}
+
+func TestTools_NegotiateCharset(t *testing.T) {
+	supported := []string{"UTF-8", "ISO-8859-1", "Shift_JIS"}
+	tests := []struct {
+		name          string
+		acceptCharset string
+		expected      string
+	}{
+		{"Missing header", "", "utf-8"},
+		{"Exact match", "iso-8859-1", "ISO-8859-1"},
+		{"Q-value ordering", "utf-8;q=0.3, shift_jis;q=0.9, iso-8859-1;q=0.5", "Shift_JIS"},
+		{"Wildcard", "*", "UTF-8"},
+		{"Explicit entry overrides wildcard", "utf-8;q=0, *;q=0.5", "ISO-8859-1"},
+		{"No match defaults to UTF-8", "koi8-r", "utf-8"},
+		{"Everything excluded defaults to UTF-8", "*;q=0", "utf-8"},
+	}
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if entry.acceptCharset != "" {
+				req.Header.Set("Accept-Charset", entry.acceptCharset)
+			}
+
+			if result := tools.NegotiateCharset(req, supported); result != entry.expected {
+				t.Errorf("expected %s, but received %s", entry.expected, result)
+			}
+		})
+	}
+}
+
+func TestTools_WriteNegotiated(t *testing.T) {
+	tests := []struct {
+		name         string
+		accept       string
+		expectedType string
+		expectedBody string
+	}{
+		{"XML", "application/xml", "application/xml", `<title>Go</title>`},
+		{"JSON", "application/json", "application/json", `"Title": "Go"`},
+		{"Any type", "*/*", "application/json", `"Title": "Go"`},
+		{"Missing header", "", "application/json", `"Title": "Go"`},
+		{"Q-value ordering", "application/json;q=0.4, application/xml;q=0.8", "application/xml", `<title>Go</title>`},
+		{"No match", "text/html", "application/json", `"Title": "Go"`},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if entry.accept != "" {
+				req.Header.Set("Accept", entry.accept)
+			}
+
+			err := tools.WriteNegotiated(rr, req, http.StatusOK, xmlBook{Title: "Go", Year: 2015})
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			if contentType := rr.Header().Get("Content-Type"); contentType != entry.expectedType {
+				t.Errorf("expected content type %s, but received %s", entry.expectedType, contentType)
+			}
+			if !strings.Contains(rr.Body.String(), entry.expectedBody) {
+				t.Errorf("expected body to contain %s, but received %s", entry.expectedBody, rr.Body.String())
+			}
+			if vary := rr.Header().Get("Vary"); vary != "Accept" {
+				t.Errorf("expected Vary: Accept, but received %q", vary)
+			}
+		})
+	}
+}
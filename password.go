@@ -0,0 +1,127 @@
+package toolkit
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// commonPasswords is a small list of frequently used passwords, compared case-insensitively
+var commonPasswords = map[string]bool{
+	"123456": true, "12345678": true, "123456789": true, "1234567890": true, "password": true,
+	"password1": true, "password123": true, "qwerty": true, "qwerty123": true, "abc123": true,
+	"111111": true, "123123": true, "iloveyou": true, "admin": true, "welcome": true,
+	"letmein": true, "monkey": true, "dragon": true, "football": true, "baseball": true,
+	"sunshine": true, "princess": true, "shadow": true, "master": true, "trustno1": true,
+	"passw0rd": true, "p@ssw0rd": true, "changeme": true, "secret": true, "login": true,
+}
+
+// keyboardSequences are scanned for runs of sequential characters in both directions
+var keyboardSequences = []string{
+	"abcdefghijklmnopqrstuvwxyz",
+	"01234567890",
+	"qwertyuiop",
+	"asdfghjkl",
+	"zxcvbnm",
+}
+
+// minSequenceLength is the length of a run that counts as a sequence or a repetition
+const minSequenceLength = 4
+
+// PasswordStrength() estimates the strength of a password on a scale from 0 (very weak) to 4 (strong).
+// The score is based on length and character variety, and is lowered for sequences, repeated
+// characters and common passwords. Reasons explain what lowered the score
+func (t *Tools) PasswordStrength(password string) (score int, reasons []string) {
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return 0, []string{"is a commonly used password"}
+	}
+
+	// Longer passwords are exponentially harder to guess
+	length := utf8.RuneCountInString(password)
+	for _, threshold := range []int{8, 12, 16, 20} {
+		if length >= threshold {
+			score++
+		}
+	}
+	if length < 8 {
+		reasons = append(reasons, "is shorter than 8 characters")
+	}
+
+	// Count the character classes in use
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	classes := 0
+	for _, has := range []bool{hasLower, hasUpper, hasDigit, hasSymbol} {
+		if has {
+			classes++
+		}
+	}
+	switch {
+	case classes >= 3:
+		score++
+	case classes <= 1:
+		score--
+		reasons = append(reasons, "uses only one kind of character")
+	}
+
+	if hasSequence(lower) {
+		score--
+		reasons = append(reasons, "contains a predictable sequence")
+	}
+
+	if hasRepetition(password) {
+		score--
+		reasons = append(reasons, "contains repeated characters")
+	}
+
+	return max(0, min(4, score)), reasons
+}
+
+// hasSequence reports whether the string contains a run of sequential letters, digits or keyboard keys
+func hasSequence(s string) bool {
+	for _, seq := range keyboardSequences {
+		reversed := []rune(seq)
+		for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+			reversed[i], reversed[j] = reversed[j], reversed[i]
+		}
+
+		for _, candidate := range []string{seq, string(reversed)} {
+			for i := 0; i+minSequenceLength <= len(candidate); i++ {
+				if strings.Contains(s, candidate[i:i+minSequenceLength]) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// hasRepetition reports whether the string contains the same character several times in a row
+func hasRepetition(s string) bool {
+	var prev rune
+	run := 0
+	for _, r := range s {
+		if r == prev {
+			run++
+		} else {
+			prev, run = r, 1
+		}
+
+		if run >= minSequenceLength {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package toolkit
+
+import "testing"
+
+func TestTools_PasswordStrength(t *testing.T) {
+	tests := []struct {
+		name          string
+		password      string
+		minScore      int
+		maxScore      int
+		expectReasons bool
+	}{
+		{"Common password", "Password1", 0, 0, true},
+		{"Short password", "aB3$", 0, 1, true},
+		{"Only lowercase", "lowercaseonly", 0, 1, true},
+		{"Sequence", "Xabcd1234!", 0, 1, true},
+		{"Repeated characters", "Zzzzzz99!!", 0, 1, true},
+		{"Strong passphrase", "correct horse battery staple", 3, 4, false},
+		{"Strong mixed password", "T7#kPq9!vW2m", 3, 4, false},
+	}
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			score, reasons := tools.PasswordStrength(entry.password)
+
+			if score < entry.minScore || score > entry.maxScore {
+				t.Errorf("expected a score between %d and %d, but received %d (%v)", entry.minScore, entry.maxScore, score, reasons)
+			}
+
+			if entry.expectReasons && len(reasons) == 0 {
+				t.Error("expected reasons for a low score, but received none")
+			}
+
+			if !entry.expectReasons && len(reasons) > 0 {
+				t.Errorf("expected no reasons, but received %v", reasons)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package toolkit
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket that refills at a steady rate up to a burst size.
+// It is safe for concurrent use
+type RateLimiter struct {
+	mu       sync.Mutex
+	rate     float64   // tokens added per second
+	burst    float64   // max tokens the bucket can hold
+	tokens   float64   // tokens currently available
+	lastSeen time.Time // last time the bucket was refilled
+}
+
+// NewRateLimiter() creates a full bucket that allows perSecond events on average
+// and bursts of up to burst events
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:     perSecond,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		lastSeen: time.Now(),
+	}
+}
+
+// refill adds the tokens accumulated since the last call, the caller must hold the lock
+func (l *RateLimiter) refill(now time.Time) {
+	elapsed := now.Sub(l.lastSeen).Seconds()
+	l.tokens = math.Min(l.burst, l.tokens+elapsed*l.rate)
+	l.lastSeen = now
+}
+
+// Allow() takes a token from the bucket, reporting whether one was available
+func (l *RateLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	if l.tokens < 1 {
+		return false
+	}
+
+	l.tokens--
+	return true
+}
+
+// RetryAfter() returns how long a client has to wait until the limiter has a token available.
+// Returns zero if a token is available right away
+func (t *Tools) RetryAfter(l *RateLimiter) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	if l.tokens >= 1 || l.rate <= 0 {
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// reserve takes n tokens from the bucket, going into debt if there are not enough, and returns
+// how long the caller has to wait until the debt is paid off. Callers reserving after it wait longer
+func (l *RateLimiter) reserve(n float64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.refill(time.Now())
+	l.tokens -= n
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// CopyRateLimited() copies from src to dst like io.Copy, taking one token of the limiter for every
+// byte so that all copies sharing the limiter are paced together. A nil limiter copies without limit
+func CopyRateLimited(dst io.Writer, src io.Reader, limiter *RateLimiter) (int64, error) {
+	if limiter == nil {
+		return io.Copy(dst, src)
+	}
+
+	// Copy at most one burst at a time, larger chunks would wait for more than the bucket holds
+	size := 32 * 1024
+	if burst := int(limiter.burst); burst > 0 && burst < size {
+		size = burst
+	}
+	buf := make([]byte, size)
+
+	var written int64
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			time.Sleep(limiter.reserve(float64(n)))
+
+			m, err := dst.Write(buf[:n])
+			written += int64(m)
+			if err != nil {
+				return written, err
+			}
+			if m != n {
+				return written, io.ErrShortWrite
+			}
+		}
+		if readErr == io.EOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+	}
+}
+
+// uploadLimiterMu guards the lazy creation of the upload limiter of every Tools value
+var uploadLimiterMu sync.Mutex
+
+// uploadRateLimiter returns the limiter shared by the uploads, creating it on first use.
+// The bucket holds one second of uploads. Returns nil when MaxUploadBytesPerSec is not set
+func (t *Tools) uploadRateLimiter() *RateLimiter {
+	if t.MaxUploadBytesPerSec <= 0 {
+		return nil
+	}
+
+	uploadLimiterMu.Lock()
+	defer uploadLimiterMu.Unlock()
+
+	if t.uploadLimiter == nil {
+		t.uploadLimiter = NewRateLimiter(float64(t.MaxUploadBytesPerSec), int(t.MaxUploadBytesPerSec))
+	}
+	return t.uploadLimiter
+}
+
+// rateLimitSweepInterval is how often RateLimit looks for buckets it can forget
+var rateLimitSweepInterval = time.Minute
+
+// clientLimiters holds the token buckets of RateLimit, one per client IP
+type clientLimiters struct {
+	mu        sync.Mutex
+	perSecond float64
+	burst     int
+	limiters  map[string]*RateLimiter
+	lastSweep time.Time
+}
+
+// get returns the bucket of the client, creating a full one for new clients
+func (c *clientLimiters) get(ip string, now time.Time) *RateLimiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) >= rateLimitSweepInterval {
+		c.sweep(now)
+	}
+
+	limiter, ok := c.limiters[ip]
+	if !ok {
+		limiter = NewRateLimiter(c.perSecond, c.burst)
+		c.limiters[ip] = limiter
+	}
+	return limiter
+}
+
+// sweep drops the buckets that have refilled completely, a new bucket would be the same.
+// The caller must hold the lock
+func (c *clientLimiters) sweep(now time.Time) {
+	for ip, limiter := range c.limiters {
+		limiter.mu.Lock()
+		full := limiter.rate > 0 && limiter.tokens+now.Sub(limiter.lastSeen).Seconds()*limiter.rate >= limiter.burst
+		limiter.mu.Unlock()
+
+		if full {
+			delete(c.limiters, ip)
+		}
+	}
+	c.lastSweep = now
+}
+
+// RateLimit() is a middleware that gives every client IP a token bucket that allows perSecond
+// requests on average and bursts of up to burst requests. Requests over the limit are rejected
+// with 429 Too Many Requests and a Retry-After header. Buckets of idle clients are dropped
+func (t *Tools) RateLimit(perSecond float64, burst int) func(http.Handler) http.Handler {
+	clients := &clientLimiters{
+		perSecond: perSecond,
+		burst:     burst,
+		limiters:  make(map[string]*RateLimiter),
+		lastSweep: time.Now(),
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter := clients.get(t.GetClientIP(r), time.Now())
+
+			if !limiter.Allow() {
+				// Retry-After is in whole seconds, round up so the client does not come back too early
+				retryAfter := int(math.Ceil(t.RetryAfter(limiter).Seconds()))
+				if retryAfter < 1 {
+					retryAfter = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				t.ClientError(w, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// byteUsage is the number of body bytes a client sent at a point in time
+type byteUsage struct {
+	at    time.Time
+	bytes int64
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// byteQuotas holds the body bytes every client IP sent within the window of ByteQuota
+type byteQuotas struct {
+	mu        sync.Mutex
+	maxBytes  int64
+	window    time.Duration
+	usage     map[string][]*byteUsage
+	lastSweep time.Time
+}
+
+// used prunes the entries of the client that left the window and returns the bytes still counted.
+// The caller must hold the lock
+func (q *byteQuotas) used(ip string, now time.Time) int64 {
+	entries := q.usage[ip]
+	for len(entries) > 0 && now.Sub(entries[0].at) >= q.window {
+		entries = entries[1:]
+	}
+	if len(entries) == 0 {
+		// Drop idle clients to keep the map from growing
+		delete(q.usage, ip)
+		return 0
+	}
+	q.usage[ip] = entries
+
+	var total int64
+	for _, e := range entries {
+		total += e.bytes
+	}
+	return total
+}
+
+// sweep prunes the entries of every client, dropping the clients that have none left,
+// so that clients that never come back are forgotten. The caller must hold the lock
+func (q *byteQuotas) sweep(now time.Time) {
+	for ip := range q.usage {
+		q.used(ip, now)
+	}
+	q.lastSweep = now
+}
+
+// reserve counts size bytes against the budget of the client, reporting whether they fit.
+// A negative size is unknown and reserves the rest of the budget. Checking and counting
+// under one lock keeps concurrent requests of a client from all passing the check
+func (q *byteQuotas) reserve(ip string, size int64, now time.Time) (*byteUsage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if now.Sub(q.lastSweep) >= rateLimitSweepInterval {
+		q.sweep(now)
+	}
+
+	spent := q.used(ip, now)
+	if size < 0 {
+		size = q.maxBytes - spent
+	}
+	if spent >= q.maxBytes || spent+size > q.maxBytes {
+		return nil, false
+	}
+
+	entry := &byteUsage{at: now, bytes: size}
+	if size > 0 {
+		q.usage[ip] = append(q.usage[ip], entry)
+	}
+	return entry, true
+}
+
+// settle replaces the bytes reserved by an entry with the bytes that were actually read
+func (q *byteQuotas) settle(entry *byteUsage, bytes int64) {
+	q.mu.Lock()
+	entry.bytes = bytes
+	q.mu.Unlock()
+}
+
+// ByteQuota() limits the total number of request body bytes a client IP can send within
+// a sliding window. Requests whose Content-Length does not fit in the rest of the budget are
+// rejected with 429 Too Many Requests. A body of unknown length holds the rest of the budget
+// while it is read and is cut off at it, like http.MaxBytesReader, the bytes it did not use
+// are released afterwards. Clients that went quiet are swept from memory periodically
+func (t *Tools) ByteQuota(maxBytes int64, window time.Duration) func(http.Handler) http.Handler {
+	quotas := &byteQuotas{
+		maxBytes:  maxBytes,
+		window:    window,
+		usage:     make(map[string][]*byteUsage),
+		lastSweep: time.Now(),
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entry, ok := quotas.reserve(t.GetClientIP(r), r.ContentLength, time.Now())
+			if !ok {
+				t.ClientError(w, http.StatusTooManyRequests)
+				return
+			}
+
+			if r.ContentLength < 0 {
+				if r.Body == nil {
+					r.Body = http.NoBody
+				}
+				// Reading past the budget fails with *http.MaxBytesError, handlers can answer 413
+				counter := &countingReader{ReadCloser: http.MaxBytesReader(w, r.Body, entry.bytes)}
+				r.Body = counter
+				defer func() { quotas.settle(entry, counter.n) }()
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package toolkit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_RetryAfter(t *testing.T) {
+	var tools Tools
+	limiter := NewRateLimiter(2, 3)
+
+	// A full bucket does not require waiting
+	if retryAfter := tools.RetryAfter(limiter); retryAfter != 0 {
+		t.Errorf("expected no wait, but received %s", retryAfter)
+	}
+
+	// Drain the bucket
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow() {
+			t.Fatalf("expected request %d to be allowed", i+1)
+		}
+	}
+
+	if limiter.Allow() {
+		t.Error("expected a drained bucket to reject the request")
+	}
+
+	// Two tokens per second means a new token every 500ms
+	retryAfter := tools.RetryAfter(limiter)
+	if retryAfter <= 400*time.Millisecond || retryAfter > 500*time.Millisecond {
+		t.Errorf("expected retry after within (400ms, 500ms], but received %s", retryAfter)
+	}
+
+	// Once the wait is over a token is available again
+	time.Sleep(retryAfter)
+	if !limiter.Allow() {
+		t.Error("expected a token to be available after waiting")
+	}
+}
+
+func TestTools_ByteQuota(t *testing.T) {
+	var tools Tools
+	quota := tools.ByteQuota(100, 200*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			tools.ClientError(w, http.StatusRequestEntityTooLarge)
+		}
+	}))
+
+	post := func(ip string, body io.Reader, contentLength int64) int {
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.ContentLength = contentLength
+		req.RemoteAddr = ip + ":1234"
+		resp := httptest.NewRecorder()
+		quota.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	payload := strings.Repeat("x", 40)
+	tests := []struct {
+		name           string
+		ip             string
+		contentLength  int64
+		expectedStatus int
+	}{
+		{"First request", "10.0.0.1", 40, http.StatusOK},
+		{"Second request", "10.0.0.1", 40, http.StatusOK},
+		{"Exceeds the budget", "10.0.0.1", 40, http.StatusTooManyRequests},
+		{"Other client", "10.0.0.2", 40, http.StatusOK},
+		// Unknown length is counted while the body is read
+		{"Unknown length", "10.0.0.2", -1, http.StatusOK},
+		{"Unknown length is cut off at the budget", "10.0.0.2", -1, http.StatusRequestEntityTooLarge},
+		{"Budget exhausted", "10.0.0.2", 10, http.StatusTooManyRequests},
+	}
+	for _, entry := range tests {
+		if code := post(entry.ip, strings.NewReader(payload), entry.contentLength); code != entry.expectedStatus {
+			t.Errorf("%s: expected status code %d, but received %d", entry.name, entry.expectedStatus, code)
+		}
+	}
+
+	// The budget is available again once the window has passed
+	time.Sleep(250 * time.Millisecond)
+	if code := post("10.0.0.1", strings.NewReader(payload), 40); code != http.StatusOK {
+		t.Errorf("expected status code %d after the window, but received %d", http.StatusOK, code)
+	}
+}
+
+func TestTools_ByteQuota_Concurrent(t *testing.T) {
+	var tools Tools
+	release := make(chan struct{})
+	quota := tools.ByteQuota(100, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		io.Copy(io.Discard, r.Body)
+	}))
+
+	// Both requests are checked before either handler has finished, only one fits in the budget
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 60)))
+			req.RemoteAddr = "10.0.0.1:1234"
+			resp := httptest.NewRecorder()
+			quota.ServeHTTP(resp, req)
+			codes <- resp.Code
+		}()
+	}
+
+	// The rejected request returns without waiting for the handler
+	if code := <-codes; code != http.StatusTooManyRequests {
+		t.Errorf("expected status code %d, but received %d", http.StatusTooManyRequests, code)
+	}
+	close(release)
+	if code := <-codes; code != http.StatusOK {
+		t.Errorf("expected status code %d, but received %d", http.StatusOK, code)
+	}
+}
+
+func TestByteQuotas_Sweep(t *testing.T) {
+	now := time.Now()
+	quotas := &byteQuotas{
+		maxBytes:  100,
+		window:    time.Second,
+		usage:     make(map[string][]*byteUsage),
+		lastSweep: now,
+	}
+
+	quotas.reserve("10.0.0.1", 40, now)
+	quotas.reserve("10.0.0.2", 40, now)
+	if len(quotas.usage) != 2 {
+		t.Fatalf("expected 2 clients, but received %d", len(quotas.usage))
+	}
+
+	// The first client never comes back, the sweep forgets it
+	later := now.Add(rateLimitSweepInterval + time.Second)
+	quotas.reserve("10.0.0.2", 40, later)
+	if _, ok := quotas.usage["10.0.0.1"]; ok {
+		t.Error("expected the idle client to be swept")
+	}
+	if len(quotas.usage["10.0.0.2"]) != 1 {
+		t.Errorf("expected 1 entry for the active client, but received %d", len(quotas.usage["10.0.0.2"]))
+	}
+}
+
+func TestTools_RateLimit(t *testing.T) {
+	var tools Tools
+	limited := tools.RateLimit(10, 3)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	get := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		resp := httptest.NewRecorder()
+		limited.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// The burst is allowed, the next request is over the limit
+	for i := 0; i < 3; i++ {
+		if code := get("10.0.0.1").Code; code != http.StatusOK {
+			t.Fatalf("expected request %d to be allowed, but received %d", i+1, code)
+		}
+	}
+	resp := get("10.0.0.1")
+	if resp.Code != http.StatusTooManyRequests {
+		t.Errorf("expected %d, but received %d", http.StatusTooManyRequests, resp.Code)
+	}
+	if retryAfter := resp.Header().Get("Retry-After"); retryAfter != "1" {
+		t.Errorf("expected Retry-After 1, but received %q", retryAfter)
+	}
+
+	// Other clients have their own bucket
+	if code := get("10.0.0.2").Code; code != http.StatusOK {
+		t.Errorf("expected another client to be allowed, but received %d", code)
+	}
+
+	// Ten tokens per second means a new token every 100ms
+	time.Sleep(150 * time.Millisecond)
+	if code := get("10.0.0.1").Code; code != http.StatusOK {
+		t.Errorf("expected the bucket to refill, but received %d", code)
+	}
+}
+
+func TestClientLimiters_Sweep(t *testing.T) {
+	start := time.Now()
+	clients := &clientLimiters{perSecond: 1, burst: 2, limiters: make(map[string]*RateLimiter), lastSweep: start}
+
+	clients.get("10.0.0.1", start).Allow()
+	clients.get("10.0.0.1", start).Allow()
+	clients.get("10.0.0.2", start).Allow()
+
+	// After a second the bucket of the second client is full again, the first one is not
+	clients.sweep(start.Add(1100 * time.Millisecond))
+	if _, ok := clients.limiters["10.0.0.2"]; ok {
+		t.Error("expected the refilled bucket to be dropped")
+	}
+	if _, ok := clients.limiters["10.0.0.1"]; !ok {
+		t.Error("expected the drained bucket to be kept")
+	}
+
+	// Sweeps happen on their own while clients are served
+	clients.get("10.0.0.3", start.Add(2*rateLimitSweepInterval))
+	if len(clients.limiters) != 1 {
+		t.Errorf("expected 1 bucket after the sweep, but received %d", len(clients.limiters))
+	}
+}
+
+func TestCopyRateLimited(t *testing.T) {
+	content := strings.Repeat("abcdefgh", 1000)
+
+	// The burst covers the first 4000 bytes, the other 4000 take 0.2s
+	limiter := NewRateLimiter(20000, 4000)
+	var dst strings.Builder
+	start := time.Now()
+	n, err := CopyRateLimited(&dst, strings.NewReader(content), limiter)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("expected no error, but received %v", err)
+	}
+	if n != int64(len(content)) || dst.String() != content {
+		t.Errorf("expected %d bytes to be copied intact, but received %d", len(content), n)
+	}
+	if elapsed < 150*time.Millisecond {
+		t.Errorf("expected the copy to take about 200ms, but it took %s", elapsed)
+	}
+
+	// No limiter copies right away
+	dst.Reset()
+	if n, err := CopyRateLimited(&dst, strings.NewReader(content), nil); err != nil || n != int64(len(content)) {
+		t.Errorf("expected %d bytes and no error, but received %d and %v", len(content), n, err)
+	}
+}
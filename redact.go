@@ -0,0 +1,68 @@
+package toolkit
+
+import (
+	"reflect"
+	"strings"
+)
+
+// redactedField replaces the values of redacted struct fields
+const redactedField = "***"
+
+// Redact() returns a copy of a struct, or of a pointed-to struct, where string fields tagged with
+// `log:"redact"` or named in RedactFields are replaced by "***". Nested structs are redacted as well.
+// The original value is left untouched, other values are returned as they are
+func (t *Tools) Redact(s interface{}) interface{} {
+	if s == nil {
+		return nil
+	}
+	return t.redactValue(reflect.ValueOf(s)).Interface()
+}
+
+// redactValue returns a redacted copy of structs and pointers to structs
+func (t *Tools) redactValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct {
+			return v
+		}
+		// Point to a redacted copy instead of the original struct
+		ptr := reflect.New(v.Elem().Type())
+		ptr.Elem().Set(t.redactValue(v.Elem()))
+		return ptr
+	case reflect.Struct:
+		// Copy the struct, including unexported fields
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+
+		for i := 0; i < cp.NumField(); i++ {
+			field, structField := cp.Field(i), cp.Type().Field(i)
+			if !field.CanSet() {
+				continue
+			}
+
+			if field.Kind() == reflect.String && t.isRedacted(structField) {
+				field.SetString(redactedField)
+				continue
+			}
+
+			field.Set(t.redactValue(field))
+		}
+		return cp
+	default:
+		return v
+	}
+}
+
+// isRedacted reports whether the struct field is tagged or configured for redaction
+func (t *Tools) isRedacted(field reflect.StructField) bool {
+	if field.Tag.Get("log") == "redact" {
+		return true
+	}
+
+	for _, name := range t.RedactFields {
+		if strings.EqualFold(field.Name, name) {
+			return true
+		}
+	}
+	return false
+}
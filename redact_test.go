@@ -0,0 +1,87 @@
+package toolkit
+
+import "testing"
+
+type redactAddress struct {
+	Street string `log:"redact"`
+	City   string
+}
+
+type redactUser struct {
+	Email    string
+	Password string `log:"redact"`
+	Token    string
+	Age      int
+	Address  redactAddress
+	Previous *redactAddress
+}
+
+func TestTools_Redact(t *testing.T) {
+	user := redactUser{
+		Email:    "ada@example.com",
+		Password: "secret",
+		Token:    "abc123",
+		Age:      36,
+		Address:  redactAddress{Street: "1 Main St", City: "London"},
+		Previous: &redactAddress{Street: "2 Side St", City: "Paris"},
+	}
+
+	tests := []struct {
+		name         string
+		redactFields []string
+		input        interface{}
+		expected     redactUser
+	}{
+		{
+			name:  "Tagged fields",
+			input: user,
+			expected: redactUser{Email: "ada@example.com", Password: "***", Token: "abc123", Age: 36,
+				Address: redactAddress{Street: "***", City: "London"}, Previous: &redactAddress{Street: "***", City: "Paris"}},
+		},
+		{
+			name:         "Configured field names",
+			redactFields: []string{"token"},
+			input:        &user,
+			expected: redactUser{Email: "ada@example.com", Password: "***", Token: "***", Age: 36,
+				Address: redactAddress{Street: "***", City: "London"}, Previous: &redactAddress{Street: "***", City: "Paris"}},
+		},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{RedactFields: entry.redactFields}
+
+			var result redactUser
+			switch redacted := tools.Redact(entry.input).(type) {
+			case redactUser:
+				result = redacted
+			case *redactUser:
+				result = *redacted
+			default:
+				t.Fatalf("unexpected type %T", redacted)
+			}
+
+			if result.Email != entry.expected.Email || result.Password != entry.expected.Password ||
+				result.Token != entry.expected.Token || result.Age != entry.expected.Age ||
+				result.Address != entry.expected.Address || *result.Previous != *entry.expected.Previous {
+				t.Errorf("expected %+v, but received %+v", entry.expected, result)
+			}
+
+			// The original must be left untouched
+			if user.Password != "secret" || user.Token != "abc123" || user.Previous.Street != "2 Side St" {
+				t.Errorf("the original value was modified: %+v", user)
+			}
+		})
+	}
+}
+
+func TestTools_Redact_NonStruct(t *testing.T) {
+	var tools Tools
+	if result := tools.Redact("plain"); result != "plain" {
+		t.Errorf("expected plain, but received %v", result)
+	}
+
+	if result := tools.Redact(nil); result != nil {
+		t.Errorf("expected nil, but received %v", result)
+	}
+}
@@ -0,0 +1,156 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// isSVGFile reports whether the file is an SVG image by its extension or detected type.
+// http.DetectContentType reports SVG files as text/xml, so the extension is checked as well
+func isSVGFile(fileName, fileType string) bool {
+	return strings.EqualFold(filepath.Ext(fileName), ".svg") || strings.HasPrefix(fileType, "image/svg+xml")
+}
+
+// sanitizeSVG parses an SVG document and writes it back without script and foreignObject elements,
+// animations that would set a link to script, event handler attributes such as onload, and
+// javascript: or data: links. Returns an error if the document is not well-formed XML
+func sanitizeSVG(r io.Reader) ([]byte, error) {
+	decoder := xml.NewDecoder(r)
+	var out bytes.Buffer
+	encoder := xml.NewEncoder(&out)
+
+	// Depth inside a removed element, zero when outside of one
+	skipDepth := 0
+	for {
+		// RawToken keeps namespace prefixes as written, so the output matches the input
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := token.(type) {
+		case xml.StartElement:
+			if skipDepth > 0 || isRemovedSVGElement(tok) {
+				skipDepth++
+				continue
+			}
+			token = sanitizeSVGElement(tok)
+		case xml.EndElement:
+			if skipDepth > 0 {
+				skipDepth--
+				continue
+			}
+			tok.Name = flattenXMLName(tok.Name)
+			token = tok
+		default:
+			if skipDepth > 0 {
+				continue
+			}
+		}
+
+		if err = encoder.EncodeToken(token); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	if out.Len() == 0 {
+		return nil, fmt.Errorf("the document is empty")
+	}
+	return out.Bytes(), nil
+}
+
+// isRemovedSVGElement reports whether the element is dropped with all of its content: scripts,
+// foreignObject, which embeds HTML such as iframes, and animations that would set a link to script
+func isRemovedSVGElement(start xml.StartElement) bool {
+	switch strings.ToLower(start.Name.Local) {
+	case "script", "foreignobject":
+		return true
+	case "set", "animate", "animatemotion", "animatetransform":
+		for _, attr := range start.Attr {
+			switch strings.ToLower(attr.Name.Local) {
+			case "attributename":
+				// Animating a link can turn it into script, whatever the values say
+				target := strings.ToLower(strings.TrimSpace(attr.Value))
+				if target == "href" || target == "xlink:href" {
+					return true
+				}
+			case "to", "from", "by", "values":
+				// values is a list separated by semicolons
+				for _, value := range strings.Split(attr.Value, ";") {
+					if isScriptURL(value) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// sanitizeSVGElement drops the event handler attributes and the javascript: and data: links of an element
+func sanitizeSVGElement(start xml.StartElement) xml.StartElement {
+	attrs := make([]xml.Attr, 0, len(start.Attr))
+	for _, attr := range start.Attr {
+		name := strings.ToLower(attr.Name.Local)
+		if strings.HasPrefix(name, "on") {
+			continue
+		}
+		if (name == "href" || name == "src" || name == "action") && isScriptURL(attr.Value) {
+			continue
+		}
+
+		attr.Name = flattenXMLName(attr.Name)
+		attrs = append(attrs, attr)
+	}
+
+	return xml.StartElement{Name: flattenXMLName(start.Name), Attr: attrs}
+}
+
+// flattenXMLName folds the raw namespace prefix into the local name,
+// so the encoder writes it back unchanged instead of declaring a new namespace
+func flattenXMLName(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
+
+// safeDataURLPrefixes are the data: URLs that cannot carry script, raster images embedded with <image>
+var safeDataURLPrefixes = []string{"data:image/png", "data:image/jpeg", "data:image/gif", "data:image/webp"}
+
+// isScriptURL reports whether a link can run script: javascript: links, and data: links other than
+// raster images, which may hold HTML or SVG documents. Case, whitespace and control characters
+// browsers skip are ignored, e.g. "java\tscript:"
+func isScriptURL(value string) bool {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, value)
+
+	if strings.HasPrefix(cleaned, "javascript:") || strings.HasPrefix(cleaned, "vbscript:") {
+		return true
+	}
+	if !strings.HasPrefix(cleaned, "data:") {
+		return false
+	}
+	for _, prefix := range safeDataURLPrefixes {
+		// The media type ends at the parameters or at the data
+		if strings.HasPrefix(cleaned, prefix+";") || strings.HasPrefix(cleaned, prefix+",") {
+			return false
+		}
+	}
+	return true
+}
@@ -1,14 +1,27 @@
 package toolkit
 
 import (
+	"bytes"
 	"crypto/rand" // cryptographically secure random number generator
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log"
 	"net/http"
+	"net/netip"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 type Logger interface {
@@ -21,36 +34,159 @@ type Logger interface {
 // Any variable of this type will have access to all the methods
 // with the receiver *Tools.
 type Tools struct {
-	MaxFileSize        int      // Specify the max size of a file permitted for uploading
-	AllowedFileTypes   []string // Specify the file types to be permitted for uploading
-	MaxJSONSize        int      // Specify the max size of a JSON payload
-	AllowUnknownFields bool     // Permit the unknown fields
-	ErrorLog           Logger   // Allow for centralized error logging
-	InfoLog            Logger   // Allow for centralized info logging
+	MaxFileSize            int                                  // Specify the max size of a file permitted for uploading
+	AllowedFileTypes       []string                             // Specify the file types to be permitted for uploading
+	MaxJSONSize            int                                  // Specify the max size of a JSON payload
+	AllowUnknownFields     bool                                 // Permit the unknown fields
+	ErrorLog               Logger                               // Allow for centralized error logging
+	InfoLog                Logger                               // Allow for centralized info logging
+	RedactedHeaders        []string                             // Specify the headers hidden by EchoRequest, defaults to Authorization and Cookie
+	MaxMediaDuration       time.Duration                        // Specify the max duration of uploaded audio and video files
+	StrictNumbers          bool                                 // Reject JSON integers that overflow their target field
+	ExtensionMimeTable     map[string][]string                  // Map file extensions to the MIME types acceptable for them
+	StrictUploadValidation bool                                 // Require a known extension that matches the detected MIME type
+	RedactFields           []string                             // Specify the struct field names masked by Redact in addition to tagged fields
+	TrustForwardedHost     bool                                 // Use X-Forwarded-Host in Hostname, only enable behind a trusted proxy
+	MaxJSONDepth           int                                  // Specify the max nesting depth of a JSON payload, zero means unlimited
+	PublicBaseURL          string                               // Specify the base URL uploaded files are served from, used by FileURL
+	CleanupOnError         *bool                                // Remove files whose upload failed midway, nil means true. Set it to a false value to keep them
+	IgnoreUnmappedFields   bool                                 // Skip files from form fields without a directory in UploadFilesByField instead of rejecting them
+	ValidateJSONUploads    bool                                 // Reject uploaded JSON files that do not parse
+	CompressOnDisk         bool                                 // Store uploaded files gzip compressed, with a .gz extension
+	CursorSecret           []byte                               // Specify the key used to sign pagination cursors
+	IdempotencyTTL         time.Duration                        // Specify how long the Idempotency middleware keeps responses, defaults to 24 hours
+	DownloadProgressFunc   func(name string, sent, total int64) // Called as DownloadStaticFile and DownloadBytes write the response, total is the response length
+	MaxResponseSize        int                                  // Specify the max size of a JSON response written by WriteJSON, zero means unlimited
+	SanitizeSVG            bool                                 // Strip scripts, event handlers and javascript: links from uploaded SVG files
+	UploadRoot             string                               // Restrict upload directories to this directory and its subdirectories
+	ValidateGzip           bool                                 // Reject uploaded gzip files that are corrupt or decompress beyond MaxDecompressedSize
+	MaxDecompressedSize    int                                  // Specify the max decompressed size of uploaded gzip files, ReadBody and Unzip, defaults to 1GB
+	MaxRandomStringLength  int                                  // Specify the max length of random strings, defaults to 4096
+	MaxFileCount           int                                  // Specify the max number of files in a single upload, zero means unlimited. Checked after the form was parsed and before any file is stored, see MaxUploadCount
+	TranscodeToUTF8        bool                                 // Convert uploaded UTF-16 and Latin-1 text files to UTF-8
+	RejectExecutables      bool                                 // Reject uploaded ELF, Mach-O and PE executables and shebang scripts
+	ValidateExtension      bool                                 // Reject files whose known extension does not match the detected MIME type, unknown extensions are let through
+	ComputeChecksum        bool                                 // Compute the SHA-256 checksum of uploaded files while they are written
+	MaxImageWidth          int                                  // Specify the max width in pixels of uploaded PNG, JPEG and GIF images
+	MaxImageHeight         int                                  // Specify the max height in pixels of uploaded PNG, JPEG and GIF images
+	MaxImagePixels         int64                                // Specify the max number of pixels of uploaded PNG, JPEG and GIF images
+	JSONKeyTransform       func(string) string                  // Rename the top-level keys of objects written by WriteJSON, e.g. to snake_case. Opt-in, the payload is encoded twice
+	OverwriteBehavior      OverwriteBehavior                    // Choose what happens when an uploaded file already exists, overwritten by default
+	MaxXMLSize             int                                  // Specify the max size of an XML payload read by ReadXML, defaults to 1MB
+	JSONDataKey            string                               // Top-level key WriteJSONWrapped nests the payload under, such as "data" or "result"
+	EnforceIfMatch         bool                                 // Reject uploads that are not renamed when the If-Match header does not match the ETag of the file they replace
+	TrustedProxies         []string                             // CIDRs or IPs of proxies whose X-Forwarded-For header GetClientIP honors
+	NormalizeTextUploads   LineEndingStyle                      // Convert the line endings of uploaded text files to this style, off when not set
+	BodyDecoders           map[string]BodyDecoder               // Decoders for further Content-Encodings of request bodies, such as "br", by encoding name
+	MaxUploadCount         int                                  // Max number of parts, files and fields, of a multipart upload. Enforced while the body is read, before anything is stored, so it stops floods of parts that MaxFileCount would only see after parsing. Both fail with ErrTooManyFiles
+	MaxArchiveDepth        int                                  // Extract zip archives nested in archives by Unzip up to this depth, nested archives are kept as files when not set
+	MaxArchiveEntries      int                                  // Specify the max number of entries Unzip extracts, nested archives included, defaults to 10000
+	AllowedRedirectHosts   []string                             // Hosts Redirect may send clients to besides the host of the request, any host when not set
+	UploadTokenSecret      []byte                               // Require uploads to carry a token made by UploadToken with this secret in the X-Upload-Token header
+	MaxUploadBytesPerSec   int64                                // Caps the combined write rate of all uploads of this Tools value in bytes per second, 0 means unlimited
+
+	metrics        *httpMetrics   // Collected by the Metrics and InFlight middlewares, created on first use
+	trustedProxies []netip.Prefix // Parsed from TrustedProxies on first use
+	proxiesParsed  bool
+	uploadLimiter  *RateLimiter // Shared by the uploads when MaxUploadBytesPerSec is set, created on first use
 }
 
+// defaultMaxRandomStringLength is used when MaxRandomStringLength is not set
+const defaultMaxRandomStringLength = 4096
+
 // RandomString() takes in an integer that defines length of random string.
 // It uses randomStrSource as the source for the return string.
-// Returns a string with the provided length.
+// Returns a string with the provided length, an empty string if the length is zero or less.
+// Lengths over MaxRandomStringLength are capped, use RandomStringE to get an error instead
 func (t *Tools) RandomString(n int) string {
-	// Preallocate a slice of runes with size 'n' to store the random characters.
-	// Convert the random string source to a slice of runes for indexing.
-	str, r := make([]rune, n), []rune(randomStrSource)
-	// Loop over each index in the 'str' slice to fill it with a random character.
-	for i := range str {
-		// Generate a random prime number using a cryptographically secure random number generator.
-		// The prime number's bit length is set to the length of the random string source (in bits).
-		p, _ := rand.Prime(rand.Reader, len(r))
-		// Convert the prime number to a uint64.
-		x, y := p.Uint64(), uint64(len(r))
-
-		// Select a character from the randomStrSource by taking the modulo of the prime number.
-		// This ensures the index is within bounds of the source slice.
-		str[i] = r[x%y]
+	n = min(n, t.maxRandomStringLength())
+
+	// crypto/rand does not fail on supported platforms, so the error can be ignored
+	str, _ := randomFromCharset(n, []rune(randomStrSource))
+	return str
+}
+
+// RandomStringE() works like RandomString, but returns an error for a negative length
+// or a length over MaxRandomStringLength instead of correcting it
+func (t *Tools) RandomStringE(n int) (string, error) {
+	if err := t.checkRandomStringLength(n); err != nil {
+		return "", err
+	}
+
+	return randomFromCharset(n, []rune(randomStrSource))
+}
+
+// RandomStringWithCharset() works like RandomString, but takes the characters from
+// the provided charset, e.g. "0123456789" for numeric codes. Each character is equally likely.
+// Returns an error if the charset is empty or the length is invalid, see RandomStringE
+func (t *Tools) RandomStringWithCharset(n int, charset string) (string, error) {
+	if charset == "" {
+		return "", errors.New("charset must not be empty")
+	}
+	if err := t.checkRandomStringLength(n); err != nil {
+		return "", err
+	}
+
+	return randomFromCharset(n, []rune(charset))
+}
+
+// maxRandomStringLength returns MaxRandomStringLength or the default of 4096
+func (t *Tools) maxRandomStringLength() int {
+	if t.MaxRandomStringLength > 0 {
+		return t.MaxRandomStringLength
+	}
+	return defaultMaxRandomStringLength
+}
+
+// checkRandomStringLength rejects negative lengths and lengths over the maximum
+func (t *Tools) checkRandomStringLength(n int) error {
+	if n < 0 {
+		return fmt.Errorf("length must not be negative, received %d", n)
+	}
+	if max := t.maxRandomStringLength(); n > max {
+		return fmt.Errorf("length must not exceed %d, received %d", max, n)
+	}
+	return nil
+}
+
+// randomFromCharset returns a random string of n runes taken from chars.
+// Random bytes from crypto/rand are mapped to the charset by rejection sampling:
+// values that would make some characters more likely than others are discarded
+func randomFromCharset(n int, chars []rune) (string, error) {
+	if n <= 0 || len(chars) == 0 {
+		return "", nil
+	}
+
+	// Draw one byte per character for small charsets, four bytes otherwise
+	width, space := 1, uint64(256)
+	if len(chars) > 256 {
+		width, space = 4, uint64(1)<<32
+	}
+	// The largest multiple of the charset size that fits, values from it upwards are rejected
+	m := uint64(len(chars))
+	limit := space - space%m
+
+	str := make([]rune, 0, n)
+	// Read some extra bytes up front, since a few values are rejected
+	buf := make([]byte, (n+n/4+8)*width)
+	for len(str) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+
+		for i := 0; i+width <= len(buf) && len(str) < n; i += width {
+			v := uint64(buf[i])
+			if width == 4 {
+				v = uint64(binary.BigEndian.Uint32(buf[i:]))
+			}
+			if v < limit {
+				str = append(str, chars[v%m])
+			}
+		}
 	}
 
 	// Convert the slice of runes into a string and return it.
-	return string(str)
+	return string(str), nil
 }
 
 // CreateNewDirectory() creates a new directory if it does not exist
@@ -71,6 +207,51 @@ func (t *Tools) CreateNewDirectory(path string) error {
 	return nil
 }
 
+// CountFiles() counts the regular files in dir whose names match the glob pattern,
+// e.g. "*.png". An empty pattern matches every file. Subdirectories are only
+// searched if the optional last parameter is set to true
+func (t *Tools) CountFiles(dir string, pattern string, recursive ...bool) (int, error) {
+	// Reject a malformed pattern up front instead of matching nothing
+	if pattern != "" {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return 0, err
+		}
+	}
+
+	matches := func(name string) bool {
+		if pattern == "" {
+			return true
+		}
+		ok, _ := filepath.Match(pattern, name)
+		return ok
+	}
+
+	count := 0
+	if len(recursive) > 0 && recursive[0] {
+		err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() && matches(d.Name()) {
+				count++
+			}
+			return nil
+		})
+		return count, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && matches(entry.Name()) {
+			count++
+		}
+	}
+	return count, nil
+}
+
 // Slugify() takes in a string and replaces all but letters and numbers with hyphens
 func (t *Tools) Slugify(str string) (string, error) {
 	trimmmed := strings.Trim(str, " ")
@@ -92,14 +273,207 @@ func (t *Tools) Slugify(str string) (string, error) {
 	return slug, nil
 }
 
+// SlugifyUnique() slugifies every title and resolves collisions within the batch
+// by appending numeric suffixes to duplicates, e.g. "x", "x-2", "x-3".
+// The order of the input is preserved.
+func (t *Tools) SlugifyUnique(titles []string) ([]string, error) {
+	slugs := make([]string, 0, len(titles))
+	// Keep track of the slugs that were already handed out
+	used := make(map[string]bool, len(titles))
+
+	for _, title := range titles {
+		slug, err := t.Slugify(title)
+		if err != nil {
+			return nil, fmt.Errorf("cannot slugify %q: %w", title, err)
+		}
+
+		// Append the smallest free suffix if the slug is already taken
+		unique := slug
+		for suffix := 2; used[unique]; suffix++ {
+			unique = fmt.Sprintf("%s-%d", slug, suffix)
+		}
+
+		used[unique] = true
+		slugs = append(slugs, unique)
+	}
+
+	return slugs, nil
+}
+
+// Initials() returns up to max uppercase initials of the words in a name,
+// e.g. "Ada Lovelace" becomes "AL". Characters other than letters and digits are skipped.
+// A max of zero or less returns the initials of every word
+func (t *Tools) Initials(name string, max int) string {
+	var initials []rune
+	for _, word := range strings.Fields(name) {
+		if max > 0 && len(initials) == max {
+			break
+		}
+
+		// Use the first letter or digit of the word
+		for _, r := range word {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				initials = append(initials, unicode.ToUpper(r))
+				break
+			}
+		}
+	}
+
+	return string(initials)
+}
+
+// contentDisposition builds an attachment Content-Disposition header for the display name.
+// Names that are not plain ASCII get an ASCII fallback in filename and the exact name in
+// filename*, percent-encoded UTF-8 as defined by RFC 5987, which browsers prefer
+func contentDisposition(displayName string) string {
+	var fallback strings.Builder
+	needsEncoding := false
+	for _, r := range displayName {
+		// Quotes, backslashes and control characters would break out of the quoted string
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			fallback.WriteByte('_')
+			needsEncoding = true
+			continue
+		}
+		fallback.WriteRune(r)
+	}
+
+	if !needsEncoding {
+		return fmt.Sprintf("attachment; filename=\"%s\"", displayName)
+	}
+
+	var encoded strings.Builder
+	for _, b := range []byte(displayName) {
+		// attr-char of RFC 5987, everything else is percent-encoded
+		if b < 0x80 && (unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b)) || strings.IndexByte("!#$&+-.^_`|~", b) >= 0) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+
+	return fmt.Sprintf("attachment; filename=\"%s\"; filename*=UTF-8''%s", fallback.String(), encoded.String())
+}
+
 // DownloadStaticFile() downloads a file from the server to the local users machine
 func (t *Tools) DownloadStaticFile(w http.ResponseWriter, r *http.Request, dirPath, fileName, displayName string) {
 	// Construct the file path by joining the provided directory path and file name
 	filePath := path.Join(dirPath, fileName)
 
 	// Set the response header to indicate a file attachment with the specified display name
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", displayName))
+	w.Header().Set("Content-Disposition", contentDisposition(displayName))
 
 	// Serve the file to the user, prompting a download
-	http.ServeFile(w, r, filePath)
+	http.ServeFile(t.trackProgress(w, displayName), r, filePath)
+}
+
+// DownloadStaticFileVerified() works like DownloadStaticFile, but first hashes the file and
+// compares its SHA-256 digest against expectedSHA256 (hex encoded). On mismatch the error is
+// logged and returned, and nothing is written to the response so the caller can send an error
+func (t *Tools) DownloadStaticFileVerified(w http.ResponseWriter, r *http.Request, dirPath, fileName, displayName, expectedSHA256 string) error {
+	filePath := path.Join(dirPath, fileName)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Hash the whole file before anything is sent to the client
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return err
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(digest, expectedSHA256) {
+		err = fmt.Errorf("checksum mismatch for %s: expected %s, got %s", filePath, expectedSHA256, digest)
+		if t.ErrorLog != nil {
+			t.ErrorLog.Println(err) // Use provided logger
+		} else {
+			log.Println(err) // Fallback to default log package
+		}
+		return err
+	}
+
+	t.DownloadStaticFile(w, r, dirPath, fileName, displayName)
+	return nil
+}
+
+// DownloadBytes() sends an in-memory buffer to the client as a file download.
+// Range requests are honored so clients can resume: a satisfiable range is answered
+// with 206 Partial Content, an unsatisfiable one with 416, a full request with 200
+func (t *Tools) DownloadBytes(w http.ResponseWriter, r *http.Request, data []byte, displayName string) {
+	// Set the response header to indicate a file attachment with the specified display name
+	w.Header().Set("Content-Disposition", contentDisposition(displayName))
+
+	// ServeContent slices the buffer according to the Range header
+	http.ServeContent(t.trackProgress(w, displayName), r, displayName, time.Time{}, bytes.NewReader(data))
+}
+
+// progressWriter reports the bytes written to the response to DownloadProgressFunc
+type progressWriter struct {
+	http.ResponseWriter
+	progress func(name string, sent, total int64)
+	name     string
+	sent     int64
+	total    int64
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	// The total is the Content-Length of the response, which is only known once headers are set
+	if p.sent == 0 {
+		p.total, _ = strconv.ParseInt(p.Header().Get("Content-Length"), 10, 64)
+	}
+
+	n, err := p.ResponseWriter.Write(b)
+	p.sent += int64(n)
+	p.progress(p.name, p.sent, p.total)
+	return n, err
+}
+
+// trackProgress wraps the response writer when DownloadProgressFunc is set
+func (t *Tools) trackProgress(w http.ResponseWriter, name string) http.ResponseWriter {
+	if t.DownloadProgressFunc == nil {
+		return w
+	}
+	return &progressWriter{ResponseWriter: w, progress: t.DownloadProgressFunc, name: name}
+}
+
+// ETag() returns a strong entity tag for the data: the quoted hex SHA-256 digest
+func (t *Tools) ETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%q", hex.EncodeToString(sum[:]))
+}
+
+// WeakETag() returns a weak entity tag for the data, the strong tag with a W/ prefix
+func (t *Tools) WeakETag(data []byte) string {
+	return "W/" + t.ETag(data)
+}
+
+// StructHash() returns the hex SHA-256 digest of the canonical JSON encoding of v, in which
+// object keys are sorted. Values that encode to the same JSON, e.g. structs with reordered fields
+// or maps built in a different order, produce the same hash. Useful to skip unchanged writes
+func (t *Tools) StructHash(v interface{}) (string, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	// Decode into generic values, which encoding/json writes back with sorted keys.
+	// Numbers are kept as written to avoid rounding large integers
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var generic interface{}
+	if err = decoder.Decode(&generic); err != nil {
+		return "", err
+	}
+
+	canonical, err := json.Marshal(generic)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
 }
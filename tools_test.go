@@ -1,11 +1,17 @@
 package toolkit
 
 import (
+	"crypto/rand"
 	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestTools_RandomString(t *testing.T) {
@@ -27,10 +33,129 @@ func TestTools_RandomString(t *testing.T) {
 			if len(s) != entry.length {
 				t.Errorf("expected length %d, received %d", entry.length, len(s))
 			}
+
+			for _, r := range s {
+				if !strings.ContainsRune(randomStrSource, r) {
+					t.Errorf("expected characters from the source, but received %q", r)
+				}
+			}
+		})
+	}
+}
+
+func TestTools_RandomString_Length(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxLength      int
+		length         int
+		expectedLength int
+		errorExpected  bool
+	}{
+		{"Negative", 0, -5, 0, true},
+		{"Zero", 0, 0, 0, false},
+		{"Normal", 0, 25, 25, false},
+		{"At the default cap", 0, 4096, 4096, false},
+		{"Over the default cap", 0, 1 << 40, 4096, true},
+		{"Over a configured cap", 10, 11, 10, true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			testTools := Tools{MaxRandomStringLength: entry.maxLength}
+
+			// RandomString corrects the length
+			if s := testTools.RandomString(entry.length); len(s) != entry.expectedLength {
+				t.Errorf("expected length %d, received %d", entry.expectedLength, len(s))
+			}
+
+			// RandomStringE reports it
+			s, err := testTools.RandomStringE(entry.length)
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but received none")
+			}
+			if !entry.errorExpected && (err != nil || len(s) != entry.length) {
+				t.Errorf("expected length %d and no error, but received %d and %v", entry.length, len(s), err)
+			}
+		})
+	}
+}
+
+func TestTools_RandomStringWithCharset(t *testing.T) {
+	// A charset larger than 256 runes is sampled from four bytes at a time
+	var large strings.Builder
+	for r := rune(0x4e00); r < 0x4e00+300; r++ {
+		large.WriteRune(r)
+	}
+
+	tests := []struct {
+		name          string
+		length        int
+		charset       string
+		errorExpected bool
+	}{
+		{"Digits", 6, "0123456789", false},
+		{"Hex", 32, "0123456789abcdef", false},
+		{"Single character", 5, "x", false},
+		{"Multibyte runes", 10, "äöüß", false},
+		{"Large charset", 50, large.String(), false},
+		{"Empty charset", 10, "", true},
+	}
+
+	var testTools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			s, err := testTools.RandomStringWithCharset(entry.length, entry.charset)
+
+			if entry.errorExpected {
+				if err == nil {
+					t.Error("expected an error, but received none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			if count := utf8.RuneCountInString(s); count != entry.length {
+				t.Errorf("expected length %d, received %d", entry.length, count)
+			}
+
+			for _, r := range s {
+				if !strings.ContainsRune(entry.charset, r) {
+					t.Errorf("expected characters from %q, but received %q", entry.charset, r)
+				}
+			}
 		})
 	}
 }
 
+// randomStringPrime is the former prime based implementation, kept to compare the speed
+func randomStringPrime(n int) string {
+	str, r := make([]rune, n), []rune(randomStrSource)
+	for i := range str {
+		p, _ := rand.Prime(rand.Reader, len(r))
+		x, y := p.Uint64(), uint64(len(r))
+		str[i] = r[x%y]
+	}
+	return string(str)
+}
+
+func BenchmarkTools_RandomString(b *testing.B) {
+	var tools Tools
+
+	b.Run("Rejection sampling", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tools.RandomString(25)
+		}
+	})
+
+	b.Run("Prime", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			randomStringPrime(25)
+		}
+	})
+}
+
 func TestTools_CreateNewDirectory(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -61,6 +186,56 @@ func TestTools_CreateNewDirectory(t *testing.T) {
 	}
 }
 
+func TestTools_CountFiles(t *testing.T) {
+	// Build a fixture directory with a nested directory
+	dir := t.TempDir()
+	for _, name := range []string{"a.png", "b.png", "c.txt", "nested/d.png", "nested/e.txt"} {
+		filePath := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		dir           string
+		pattern       string
+		recursive     bool
+		expected      int
+		errorExpected bool
+	}{
+		{"All files", dir, "", false, 3, false},
+		{"Filtered files", dir, "*.png", false, 2, false},
+		{"All files recursively", dir, "", true, 5, false},
+		{"Filtered files recursively", dir, "*.png", true, 3, false},
+		{"No match", dir, "*.gif", false, 0, false},
+		{"Bad pattern", dir, "[", false, 0, true},
+		{"Missing directory", filepath.Join(dir, "missing"), "", false, 0, true},
+	}
+
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			count, err := tools.CountFiles(entry.dir, entry.pattern, entry.recursive)
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but received none")
+			}
+
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %v", err)
+			}
+
+			if !entry.errorExpected && count != entry.expected {
+				t.Errorf("expected %d files, but received %d", entry.expected, count)
+			}
+		})
+	}
+}
+
 func TestTools_Slugify(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -93,6 +268,67 @@ func TestTools_Slugify(t *testing.T) {
 
 }
 
+func TestTools_SlugifyUnique(t *testing.T) {
+	tests := []struct {
+		name     string
+		titles   []string
+		expected []string
+		err      bool
+	}{
+		{"No duplicates", []string{"Hello", "World"}, []string{"hello", "world"}, false},
+		{"Duplicates", []string{"x", "X!", " x "}, []string{"x", "x-2", "x-3"}, false},
+		{"Duplicates keep order", []string{"a", "b", "a"}, []string{"a", "b", "a-2"}, false},
+		{"Suffix already taken", []string{"x-2", "x", "x"}, []string{"x-2", "x", "x-3"}, false},
+		{"Empty slug", []string{"hello", "!!!"}, nil, true},
+	}
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			result, err := tools.SlugifyUnique(entry.titles)
+
+			if err != nil && !entry.err {
+				t.Errorf("expected no error, but received %+v", err)
+			}
+
+			if err == nil && entry.err {
+				t.Error("expected an error, but received none")
+			}
+
+			if strings.Join(result, ",") != strings.Join(entry.expected, ",") {
+				t.Errorf("expected %v, but received %v", entry.expected, result)
+			}
+		})
+	}
+}
+
+func TestTools_Initials(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		max      int
+		expected string
+	}{
+		{"Single word", "madonna", 2, "M"},
+		{"Multiple words", "Ada Lovelace", 2, "AL"},
+		{"Multiple spaces", "  ada    lovelace  ", 2, "AL"},
+		{"Max cap", "Grace Brewster Murray Hopper", 2, "GB"},
+		{"No cap", "Grace Brewster Murray Hopper", 0, "GBMH"},
+		{"Unicode", "лев толстой", 2, "ЛТ"},
+		{"Punctuation", "(Ada) !Lovelace", 3, "AL"},
+		{"Empty", "   ", 2, ""},
+	}
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			result := tools.Initials(entry.input, entry.max)
+
+			if result != entry.expected {
+				t.Errorf("expected %s, but received %s", entry.expected, result)
+			}
+		})
+	}
+}
+
 func TestTools_DownloadStaticFile(t *testing.T) {
 	// Define and initialize response recorder and request
 	resp := httptest.NewRecorder()
@@ -125,3 +361,239 @@ func TestTools_DownloadStaticFile(t *testing.T) {
 	}
 
 }
+
+func TestTools_DownloadBytes(t *testing.T) {
+	data := []byte("0123456789")
+	tests := []struct {
+		name                 string
+		rangeHeader          string
+		expectedStatus       int
+		expectedBody         string
+		expectedContentRange string
+	}{
+		{"Full request", "", http.StatusOK, "0123456789", ""},
+		{"Valid range", "bytes=2-5", http.StatusPartialContent, "2345", "bytes 2-5/10"},
+		{"Open range", "bytes=7-", http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"Out of bounds range", "bytes=20-30", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+	}
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/download", nil)
+			if entry.rangeHeader != "" {
+				req.Header.Set("Range", entry.rangeHeader)
+			}
+			resp := httptest.NewRecorder()
+
+			tools.DownloadBytes(resp, req, data, "digits.txt")
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("expected status code %d, but received %d", entry.expectedStatus, resp.Code)
+			}
+
+			if entry.expectedStatus != http.StatusRequestedRangeNotSatisfiable && resp.Body.String() != entry.expectedBody {
+				t.Errorf("expected body %s, but received %s", entry.expectedBody, resp.Body.String())
+			}
+
+			if contentRange := resp.Header().Get("Content-Range"); contentRange != entry.expectedContentRange {
+				t.Errorf("expected Content-Range %s, but received %s", entry.expectedContentRange, contentRange)
+			}
+
+			if resp.Header().Get("Content-Disposition") != "attachment; filename=\"digits.txt\"" {
+				t.Error("wrong content-disposition of", resp.Header().Get("Content-Disposition"))
+			}
+		})
+	}
+}
+
+func TestTools_DownloadContentDisposition(t *testing.T) {
+	tests := []struct {
+		name        string
+		displayName string
+		expected    string
+	}{
+		{"ASCII", "report.pdf", `attachment; filename="report.pdf"`},
+		{"Cyrillic", "Привет.pdf", `attachment; filename="______.pdf"; filename*=UTF-8''%D0%9F%D1%80%D0%B8%D0%B2%D0%B5%D1%82.pdf`},
+		{"Accents and spaces", "résumé final.pdf", `attachment; filename="r_sum_ final.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9%20final.pdf`},
+		{"Quotes", `say "hi".txt`, `attachment; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`},
+		{"Line break", "a\r\nSet-Cookie: x.txt", `attachment; filename="a__Set-Cookie: x.txt"; filename*=UTF-8''a%0D%0ASet-Cookie%3A%20x.txt`},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+
+			// Every download helper sets the same header
+			bytesResp := httptest.NewRecorder()
+			tools.DownloadBytes(bytesResp, httptest.NewRequest(http.MethodGet, "/", nil), []byte("data"), entry.displayName)
+
+			fileResp := httptest.NewRecorder()
+			tools.DownloadStaticFile(fileResp, httptest.NewRequest(http.MethodGet, "/", nil), "./testdata", "img.png", entry.displayName)
+
+			for _, header := range []string{bytesResp.Header().Get("Content-Disposition"), fileResp.Header().Get("Content-Disposition")} {
+				if header != entry.expected {
+					t.Errorf("expected %s, but received %s", entry.expected, header)
+				}
+			}
+		})
+	}
+}
+
+func TestTools_DownloadProgressFunc(t *testing.T) {
+	tests := []struct {
+		name          string
+		download      func(tools *Tools, w http.ResponseWriter, r *http.Request)
+		expectedTotal int64
+	}{
+		{"Static file", func(tools *Tools, w http.ResponseWriter, r *http.Request) {
+			tools.DownloadStaticFile(w, r, "./testdata", "img.png", "img.png")
+		}, 5003},
+		{"Large buffer", func(tools *Tools, w http.ResponseWriter, r *http.Request) {
+			tools.DownloadBytes(w, r, make([]byte, 100*1024), "zeros.bin")
+		}, 100 * 1024},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var calls, lastSent, lastTotal int64
+			tools := &Tools{DownloadProgressFunc: func(name string, sent, total int64) {
+				if sent < lastSent {
+					t.Errorf("expected progress to increase, but received %d after %d", sent, lastSent)
+				}
+				calls++
+				lastSent, lastTotal = sent, total
+			}}
+
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/download", nil)
+			entry.download(tools, resp, req)
+
+			if calls == 0 {
+				t.Fatal("expected progress callbacks, but received none")
+			}
+
+			if lastSent != lastTotal || lastTotal != entry.expectedTotal {
+				t.Errorf("expected final progress %d/%d, but received %d/%d", entry.expectedTotal, entry.expectedTotal, lastSent, lastTotal)
+			}
+		})
+	}
+}
+
+func TestTools_DownloadStaticFileVerified(t *testing.T) {
+	tests := []struct {
+		name           string
+		fileName       string
+		checksum       string
+		errorExpected  bool
+		expectedStatus int
+	}{
+		{"Matching checksum", "img.png", "80728a5f476d2d62dbaa1da211e98ea7af78d7c2d536cb1ba520bec32b465b73", false, http.StatusOK},
+		{"Uppercase checksum", "img.png", "80728A5F476D2D62DBAA1DA211E98EA7AF78D7C2D536CB1BA520BEC32B465B73", false, http.StatusOK},
+		{"Mismatched checksum", "img.png", "0000000000000000000000000000000000000000000000000000000000000000", true, http.StatusOK},
+		{"Missing file", "missing.png", "", true, http.StatusOK},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{ErrorLog: log.New(io.Discard, "", 0)}
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/download", nil)
+
+			err := tools.DownloadStaticFileVerified(resp, req, "./testdata", entry.fileName, "hello-world.png", entry.checksum)
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but received none")
+			}
+
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %+v", err)
+			}
+
+			// The file is only served when the checksum matches
+			if !entry.errorExpected && resp.Body.Len() != 5003 {
+				t.Errorf("expected 5003 bytes to be served, but received %d", resp.Body.Len())
+			}
+
+			if entry.errorExpected && resp.Body.Len() != 0 {
+				t.Errorf("expected nothing to be served, but received %d bytes", resp.Body.Len())
+			}
+		})
+	}
+}
+
+func TestTools_ETag(t *testing.T) {
+	var tools Tools
+	etagFormat := regexp.MustCompile(`^"[0-9a-f]{64}"$`)
+
+	strong := tools.ETag([]byte("hello"))
+	if !etagFormat.MatchString(strong) {
+		t.Errorf("expected a quoted hex digest, but received %s", strong)
+	}
+
+	weak := tools.WeakETag([]byte("hello"))
+	if weak != "W/"+strong {
+		t.Errorf("expected W/%s, but received %s", strong, weak)
+	}
+
+	if tools.ETag([]byte("hello")) != strong {
+		t.Error("expected identical data to produce identical tags")
+	}
+
+	if tools.ETag([]byte("world")) == strong {
+		t.Error("expected different data to produce different tags")
+	}
+}
+
+func TestTools_StructHash(t *testing.T) {
+	type account struct {
+		Name  string            `json:"name"`
+		Email string            `json:"email"`
+		Tags  map[string]string `json:"tags"`
+	}
+	// The same fields declared in another order
+	type reordered struct {
+		Tags  map[string]string `json:"tags"`
+		Email string            `json:"email"`
+		Name  string            `json:"name"`
+	}
+
+	// Maps built in a different insertion order
+	tags := map[string]string{"role": "admin", "team": "core"}
+	reorderedTags := map[string]string{}
+	reorderedTags["team"] = "core"
+	reorderedTags["role"] = "admin"
+
+	base := account{Name: "Ada", Email: "ada@example.com", Tags: tags}
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected bool
+	}{
+		{"Same value", account{Name: "Ada", Email: "ada@example.com", Tags: tags}, true},
+		{"Reordered map keys", account{Name: "Ada", Email: "ada@example.com", Tags: reorderedTags}, true},
+		{"Reordered struct fields", reordered{Name: "Ada", Email: "ada@example.com", Tags: tags}, true},
+		{"Changed value", account{Name: "Ada", Email: "ada@example.org", Tags: tags}, false},
+		{"Changed map value", account{Name: "Ada", Email: "ada@example.com", Tags: map[string]string{"role": "user", "team": "core"}}, false},
+	}
+
+	var tools Tools
+	baseHash, err := tools.StructHash(base)
+	if err != nil {
+		t.Fatal("expected no error, but received", err)
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			hash, err := tools.StructHash(entry.value)
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			if (hash == baseHash) != entry.expected {
+				t.Errorf("expected equal hashes to be %t, but received %s and %s", entry.expected, baseHash, hash)
+			}
+		})
+	}
+
+	if _, err := tools.StructHash(make(chan int)); err == nil {
+		t.Error("expected an error for a value that cannot be encoded, but received none")
+	}
+}
@@ -0,0 +1,82 @@
+package toolkit
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTools_TOTPCode(t *testing.T) {
+	var tools Tools
+	tests := []struct {
+		name     string
+		unix     int64
+		expected string
+	}{
+		// The last six digits of the eight digit codes in RFC 6238, appendix B
+		{"59", 59, "287082"},
+		{"1111111109", 1111111109, "081804"},
+		{"1111111111", 1111111111, "050471"},
+		{"1234567890", 1234567890, "005924"},
+		{"2000000000", 2000000000, "279037"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			code, err := tools.TOTPCode(rfcSecret, time.Unix(entry.unix, 0))
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+			if code != entry.expected {
+				t.Errorf("expected %s, but received %s", entry.expected, code)
+			}
+		})
+	}
+
+	if _, err := tools.TOTPCode("not base32!", time.Now()); err == nil {
+		t.Error("expected an error for an invalid secret, but received none")
+	}
+}
+
+func TestTools_ValidateTOTP(t *testing.T) {
+	var tools Tools
+	secret, err := tools.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generatedAt := time.Unix(1_700_000_010, 0)
+	code, err := tools.TOTPCode(secret, generatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		code     string
+		skew     int
+		expected bool
+	}{
+		{"Same step", generatedAt, code, 0, true},
+		{"Next step without skew", generatedAt.Add(30 * time.Second), code, 0, false},
+		{"Next step within skew", generatedAt.Add(30 * time.Second), code, 1, true},
+		{"Previous step within skew", generatedAt.Add(-30 * time.Second), code, 1, true},
+		{"Outside skew", generatedAt.Add(90 * time.Second), code, 2, false},
+		{"Wrong code", generatedAt, "000000", 1, code == "000000"},
+		{"Wrong length", generatedAt, code[:5], 1, false},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			if valid := validateTOTPAt(secret, entry.code, entry.skew, entry.at); valid != entry.expected {
+				t.Errorf("expected %t, but received %t", entry.expected, valid)
+			}
+		})
+	}
+
+	// The current code is valid right now
+	if code, _ := tools.TOTPCode(secret, time.Now()); !tools.ValidateTOTP(secret, code, 1) {
+		t.Error("expected the current code to be valid")
+	}
+}
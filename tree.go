@@ -0,0 +1,67 @@
+package toolkit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TreeNode is an item of a tree, such as a category or a menu entry. Items without
+// a ParentID are the roots of the tree
+type TreeNode struct {
+	ID       string      `json:"id"`
+	ParentID string      `json:"parentId,omitempty"`
+	Data     interface{} `json:"data,omitempty"`
+	Children []TreeNode  `json:"children,omitempty"` // Do not include for leaves
+}
+
+// BuildTree() nests flat items, such as rows loaded from a database, under their parents and
+// returns the roots. Items keep their order among their siblings. Returns an error for duplicate
+// IDs, for orphans whose parent is missing, and for items that are part of a cycle
+func (t *Tools) BuildTree(items []TreeNode) ([]TreeNode, error) {
+	ids := make(map[string]bool, len(items))
+	for _, item := range items {
+		if ids[item.ID] {
+			return nil, fmt.Errorf("duplicate tree node ID %q", item.ID)
+		}
+		ids[item.ID] = true
+	}
+
+	// Group the items under their parents, checking that every parent exists
+	children := make(map[string][]TreeNode)
+	var orphans []string
+	for _, item := range items {
+		if item.ParentID != "" && !ids[item.ParentID] {
+			orphans = append(orphans, item.ID)
+			continue
+		}
+		children[item.ParentID] = append(children[item.ParentID], item)
+	}
+	if len(orphans) > 0 {
+		return nil, fmt.Errorf("tree nodes with a missing parent: %s", strings.Join(orphans, ", "))
+	}
+
+	// Descend from the roots, items that are never reached are part of a cycle
+	placed := make(map[string]bool, len(items))
+	var attach func(parentID string) []TreeNode
+	attach = func(parentID string) []TreeNode {
+		nodes := children[parentID]
+		for i := range nodes {
+			placed[nodes[i].ID] = true
+			nodes[i].Children = attach(nodes[i].ID)
+		}
+		return nodes
+	}
+	roots := attach("")
+
+	if len(placed) < len(items) {
+		var cyclic []string
+		for _, item := range items {
+			if !placed[item.ID] {
+				cyclic = append(cyclic, item.ID)
+			}
+		}
+		return nil, fmt.Errorf("tree nodes in a cycle: %s", strings.Join(cyclic, ", "))
+	}
+
+	return roots, nil
+}
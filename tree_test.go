@@ -0,0 +1,82 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTools_BuildTree(t *testing.T) {
+	tests := []struct {
+		name          string
+		items         []TreeNode
+		expected      string
+		errorExpected string
+	}{
+		{
+			name: "Multi-level tree",
+			items: []TreeNode{
+				{ID: "3", ParentID: "1", Data: "Phones"},
+				{ID: "1", Data: "Electronics"},
+				{ID: "4", ParentID: "3", Data: "Cases"},
+				{ID: "2", Data: "Books"},
+				{ID: "5", ParentID: "1", Data: "Laptops"},
+			},
+			expected: `[{"id":"1","data":"Electronics","children":[` +
+				`{"id":"3","parentId":"1","data":"Phones","children":[{"id":"4","parentId":"3","data":"Cases"}]},` +
+				`{"id":"5","parentId":"1","data":"Laptops"}]},` +
+				`{"id":"2","data":"Books"}]`,
+		},
+		{
+			name:     "Empty",
+			items:    nil,
+			expected: `null`,
+		},
+		{
+			name: "Cycle",
+			items: []TreeNode{
+				{ID: "1"},
+				{ID: "2", ParentID: "3"},
+				{ID: "3", ParentID: "2"},
+			},
+			errorExpected: "tree nodes in a cycle: 2, 3",
+		},
+		{
+			name:          "Self reference",
+			items:         []TreeNode{{ID: "1", ParentID: "1"}},
+			errorExpected: "tree nodes in a cycle: 1",
+		},
+		{
+			name:          "Orphan",
+			items:         []TreeNode{{ID: "1"}, {ID: "2", ParentID: "9"}},
+			errorExpected: "tree nodes with a missing parent: 2",
+		},
+		{
+			name:          "Duplicate ID",
+			items:         []TreeNode{{ID: "1"}, {ID: "1"}},
+			errorExpected: `duplicate tree node ID "1"`,
+		},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			roots, err := tools.BuildTree(entry.items)
+			if entry.errorExpected != "" {
+				if err == nil || err.Error() != entry.errorExpected {
+					t.Fatalf("expected error %q, but received %v", entry.errorExpected, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			tree, err := json.Marshal(roots)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(tree) != entry.expected {
+				t.Errorf("expected %s, but received %s", entry.expected, tree)
+			}
+		})
+	}
+}
@@ -1,24 +1,193 @@
 package toolkit
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
+	"image"
+	_ "image/gif"  // Register the GIF decoder for image.DecodeConfig
+	_ "image/jpeg" // Register the JPEG decoder for image.DecodeConfig
+	_ "image/png"  // Register the PNG decoder for image.DecodeConfig
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+)
+
+// OverwriteBehavior controls what happens when an uploaded file would replace an existing one
+type OverwriteBehavior int
+
+const (
+	Overwrite       OverwriteBehavior = iota // Replace the existing file, the default
+	OverwriteError                           // Reject the upload with an error
+	OverwriteRename                          // Append -1, -2 and so on to the name until it is unique
 )
 
 // UploadedFile is a struct used to save information about an uploaded file
 type UploadedFile struct {
 	NewFileName      string
 	OriginalFileName string
-	FileSize         int64
+	FileSize         int64  // Size on disk, compressed if CompressOnDisk is set
+	UncompressedSize int64  // Size of the original file
+	Charset          string // Charset of the original text file, only detected when TranscodeToUTF8 is set
+	Checksum         string // Hex SHA-256 digest of the stored content before compression, only computed when ComputeChecksum is set
 }
 
 const randomStrSource = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!=+"
 
+// defaultExtensionMimeTable maps common file extensions to the MIME types
+// http.DetectContentType reports for them. Used when ExtensionMimeTable is not set
+var defaultExtensionMimeTable = map[string][]string{
+	".png":  {"image/png"},
+	".jpg":  {"image/jpeg"},
+	".jpeg": {"image/jpeg"},
+	".gif":  {"image/gif"},
+	".webp": {"image/webp"},
+	".bmp":  {"image/bmp"},
+	".ico":  {"image/x-icon"},
+	".svg":  {"image/svg+xml", "text/xml", "text/plain"},
+	".pdf":  {"application/pdf"},
+	".txt":  {"text/plain"},
+	".csv":  {"text/csv", "text/plain"},
+	".json": {"application/json", "text/plain"},
+	".xml":  {"text/xml", "application/xml"},
+	".html": {"text/html"},
+	".zip":  {"application/zip"},
+	".gz":   {"application/x-gzip"},
+	".mp3":  {"audio/mpeg"},
+	".wav":  {"audio/wave"},
+	".ogg":  {"application/ogg"},
+	".mp4":  {"video/mp4"},
+	".webm": {"video/webm"},
+}
+
+// validateExtension checks that the detected MIME type is acceptable for the extension of the file name.
+// Unknown extensions are rejected when requireKnown is set, and let through otherwise
+func (t *Tools) validateExtension(fileName, fileType string, requireKnown bool) error {
+	table := t.ExtensionMimeTable
+	if table == nil {
+		table = defaultExtensionMimeTable
+	}
+
+	ext := strings.ToLower(filepath.Ext(fileName))
+	mimeTypes, ok := table[ext]
+	if !ok && !requireKnown {
+		return nil
+	}
+	if !ok {
+		return newUploadError(ErrDisallowedType, fileName, 0, "the extension %q of %s is not permitted", ext, fileName)
+	}
+
+	// Ignore parameters such as "; charset=utf-8"
+	mediaType, _, _ := strings.Cut(fileType, ";")
+	for _, m := range mimeTypes {
+		if strings.EqualFold(strings.TrimSpace(mediaType), m) {
+			return nil
+		}
+	}
+
+	return newUploadError(ErrDisallowedType, fileName, 0, "the content of %s is %s, which does not match its extension %q", fileName, mediaType, ext)
+}
+
+// FileURL() returns the public URL of an uploaded file by joining PublicBaseURL
+// with its NewFileName. Names containing directories, e.g. date partitions, are
+// joined segment by segment, and each segment is escaped
+func (t *Tools) FileURL(f *UploadedFile) string {
+	segments := strings.Split(filepath.ToSlash(f.NewFileName), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.TrimRight(t.PublicBaseURL, "/") + "/" + strings.Join(segments, "/")
+}
+
+// maxFileNameLength is the longest name, in bytes, accepted by common file systems
+const maxFileNameLength = 255
+
+// windowsReservedNames are device names Windows refuses as file names, with or without an extension
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SafeFileName() returns a version of the name that is safe to store on any platform.
+// Path separators, characters illegal on Windows and control characters are stripped,
+// trailing dots and spaces are trimmed, reserved device names such as CON.txt get an
+// underscore appended to the base name, and the name is shortened to 255 bytes keeping
+// its extension. Returns an error if nothing usable is left
+func (t *Tools) SafeFileName(name string) (string, error) {
+	// Strip the characters that are not permitted in file names
+	cleaned := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return -1
+		}
+		return r
+	}, name)
+
+	// Windows silently drops trailing dots and spaces, which makes names collide
+	cleaned = strings.TrimLeft(strings.TrimRight(cleaned, ". "), " ")
+	if cleaned == "" {
+		return "", fmt.Errorf("the file name %q is not usable", name)
+	}
+
+	// Reserved names are reserved regardless of the extension, e.g. CON.txt
+	ext := filepath.Ext(cleaned)
+	base := strings.TrimSuffix(cleaned, ext)
+	if base == "" {
+		// Dot files such as .env have no extension
+		base, ext = cleaned, ""
+	}
+	stem, _, _ := strings.Cut(base, ".")
+	if windowsReservedNames[strings.ToUpper(strings.TrimSpace(stem))] {
+		base += "_"
+	}
+
+	// Shorten the base name, keeping the extension and whole runes
+	if len(ext) >= maxFileNameLength {
+		ext = ""
+	}
+	for len(base)+len(ext) > maxFileNameLength {
+		_, size := utf8.DecodeLastRuneInString(base)
+		base = base[:len(base)-size]
+	}
+	base = strings.TrimRight(base, ". ")
+	if base == "" {
+		return "", fmt.Errorf("the file name %q is not usable", name)
+	}
+
+	return base + ext, nil
+}
+
+// originalBaseName strips the directories from a client provided file name, with either
+// kind of separator. Names that try to climb up with ".." are rejected instead of cleaned
+func originalBaseName(name string) (string, error) {
+	segments := strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' })
+	for _, segment := range segments {
+		if segment == ".." {
+			return "", fmt.Errorf("the file name %q is not permitted", name)
+		}
+	}
+	if len(segments) == 0 {
+		return "", fmt.Errorf("the file name %q is not permitted", name)
+	}
+
+	return segments[len(segments)-1], nil
+}
+
 // UploadOneFile is a convenience method that calls UploadFiles
 // Expectes only one file to be uploaded
 func (t *Tools) UploadOneFile(r *http.Request, uploadDir string, rename ...bool) (*UploadedFile, error) {
@@ -40,8 +209,19 @@ func (t *Tools) UploadOneFile(r *http.Request, uploadDir string, rename ...bool)
 // Returns a slice of with the newly named files, the original file names, file sizes, and
 // a potential error. If the optional last parameter is set to true, the files will not be renamed
 func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) ([]*UploadedFile, error) {
-	// Create uploads directory if it doesnt exist
-	err := t.CreateNewDirectory("./testdata/uploads")
+	// An empty field name accepts the files of every field
+	return t.UploadFilesFromField(r, "", uploadDir, rename...)
+}
+
+// UploadFilesFromField works like UploadFiles, but only uploads the files submitted under
+// the given form field, files of other fields are ignored. An empty field name means all fields
+func (t *Tools) UploadFilesFromField(r *http.Request, fieldName, uploadDir string, rename ...bool) ([]*UploadedFile, error) {
+	// Clean the upload directory, check it against UploadRoot and create it if it doesnt exist
+	uploadDir, err := t.prepareUploadDir(uploadDir)
+	if err != nil {
+		return nil, err
+	}
+
 	// Rename by default
 	renameFile := true
 
@@ -50,113 +230,857 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 		renameFile = rename[0]
 	}
 
-	// Preallocate a slice to store the files
+	files, err := t.uploadFormFiles(r, renameFile, func(field string) (string, bool, error) {
+		return uploadDir, fieldName == "" || field == fieldName, nil
+	})
+
+	// In case of error, return what was successfully uploaded
 	var uploadedFiles []*UploadedFile
+	for _, fieldFiles := range files {
+		uploadedFiles = append(uploadedFiles, fieldFiles...)
+	}
+	return uploadedFiles, err
+}
 
-	// Assign MaxFileSize if it is not set
-	if t.MaxFileSize == 0 {
-		// Set a default limit
-		t.MaxFileSize = 1024 * 1024 * 1024
+// UploadFilesByField uploads the files of each form field to the directory mapped to that field.
+// Returns the uploaded files grouped by field name. Files from a field missing in dirs are
+// rejected, or skipped when IgnoreUnmappedFields is set. If the optional last parameter
+// is set to false, the files will not be renamed
+func (t *Tools) UploadFilesByField(r *http.Request, dirs map[string]string, rename ...bool) (map[string][]*UploadedFile, error) {
+	// Rename by default
+	renameFile := true
+	if len(rename) > 0 {
+		renameFile = rename[0]
 	}
 
-	// Check for an error when parsing the request
-	err = r.ParseMultipartForm(int64(t.MaxFileSize))
-	if err != nil {
-		return nil, errors.New("the uploaded file is too big")
-	}
-
-	// Check if any files are stored in the request
-	for _, headers := range r.MultipartForm.File {
-		for _, hdr := range headers {
-			// Wrap defer in a function
-			uploadedFiles, err = func(UploadedFiles []*UploadedFile) ([]*UploadedFile, error) {
-				var uploadedFile UploadedFile
-				// Open the header
-				infile, err := hdr.Open()
-				if err != nil {
-					return nil, err
-				}
-				// Close in order to avoid resource leak
-				defer infile.Close()
-
-				// We need to look at the first 512 bytes to find out the type of file
-				buff := make([]byte, 512)
-				_, err = infile.Read(buff) // Read the bytes
-				if err != nil {
-					return nil, err
-				}
-
-				// Check to see if the file type is permitted
-				// Assume that the file type is not allowed
-				allowed := false
-				fileType := http.DetectContentType(buff) // Get file type of the bytes
-
-				// Check if the AllowedFileTypes was populated
-				if len(t.AllowedFileTypes) > 0 {
-					for _, f := range t.AllowedFileTypes {
-						// If current file type equals one of the permitted file types...
-						if strings.EqualFold(fileType, f) {
-							// ...allow the file
-							allowed = true
-						}
-					}
-					// if AllowedFileTypes was not populated...
-				} else {
-					// ...allow all files
-					allowed = true
-				}
-
-				// If allowed is still false, return an error
-				if !allowed {
-					return nil, errors.New("the uploaded file type is not permitted")
-				}
-
-				// Since we read the beginning of the file,
-				// We have to go back to the beginning of the file
-				_, err = infile.Seek(0, 0)
-				if err != nil {
-					return nil, err
-				}
-
-				// If its going to be renamed - generate a new name with original extension
-				if renameFile {
-					uploadedFile.NewFileName = fmt.Sprintf("%s%s", t.RandomString(25), filepath.Ext(hdr.Filename))
-				} else {
-					uploadedFile.NewFileName = hdr.Filename
-				}
-
-				uploadedFile.OriginalFileName = hdr.Filename
-
-				// Save to disk
-				var outfile *os.File  // file we will write to
-				defer outfile.Close() // close the file when the function exists
-
-				// Write the file to the provided directory
-				if outfile, err = os.Create(filepath.Join(uploadDir, uploadedFile.NewFileName)); err != nil {
-					return nil, err
-				} else {
-					fileSize, err := io.Copy(outfile, infile)
-					if err != nil {
-						return nil, err
-					}
-
-					uploadedFile.FileSize = fileSize
-				}
-
-				// Append the file to the slice of uploadedFiles
-				uploadedFiles = append(uploadedFiles, &uploadedFile)
-
-				return uploadedFiles, nil
-
-				// give the function access to uploadedFiles
-			}(uploadedFiles)
-
-			// In case of error, return what was successfully uploaded
+	return t.uploadFormFiles(r, renameFile, func(field string) (string, bool, error) {
+		uploadDir, ok := dirs[field]
+		if !ok {
+			if t.IgnoreUnmappedFields {
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("the form field %q is not permitted", field)
+		}
+
+		uploadDir, err := t.prepareUploadDir(uploadDir)
+		return uploadDir, err == nil, err
+	})
+}
+
+// uploadFormFiles checks the upload token, parses the multipart form and saves the files of the
+// fields that selectDir picks, to the directory it returns for them. The fields are picked, and
+// MaxFileCount and the If-Match precondition are checked, before anything is written. Returns the uploaded files grouped
+// by field, in case of error the files that were successfully uploaded
+func (t *Tools) uploadFormFiles(r *http.Request, renameFile bool, selectDir func(field string) (string, bool, error)) (map[string][]*UploadedFile, error) {
+	// Check the upload token when UploadTokenSecret is set, its fields may narrow the limits
+	limits, err := t.authorizeUpload(r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.parseUploadForm(r, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pick the directory of every field before writing anything to disk
+	uploadDirs := make(map[string]string)
+	for field := range r.MultipartForm.File {
+		uploadDir, ok, err := selectDir(field)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			uploadDirs[field] = uploadDir
+		}
+	}
+
+	// Count the files of the picked fields, an upload over MaxFileCount stores nothing
+	if t.MaxFileCount > 0 {
+		count := 0
+		for field := range uploadDirs {
+			count += len(r.MultipartForm.File[field])
+		}
+		if count > t.MaxFileCount {
+			return nil, newUploadError(ErrTooManyFiles, "", int64(t.MaxFileCount), "too many files uploaded")
+		}
+	}
+
+	// Check the If-Match precondition of every file as well
+	if !renameFile {
+		for field, uploadDir := range uploadDirs {
+			if err := t.checkIfMatch(r, uploadDir, r.MultipartForm.File[field]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	uploadedFiles := make(map[string][]*UploadedFile)
+	for field, uploadDir := range uploadDirs {
+		for _, hdr := range r.MultipartForm.File[field] {
+			uploadedFile, err := t.saveUploadedFile(hdr, uploadDir, renameFile, limits)
 			if err != nil {
 				return uploadedFiles, err
 			}
+
+			uploadedFiles[field] = append(uploadedFiles[field], uploadedFile)
 		}
 	}
 
 	return uploadedFiles, nil
 }
+
+// ErrPreconditionFailed is returned by the upload methods when EnforceIfMatch is set and the
+// If-Match header does not match the file an upload would replace. Respond with 412 Precondition Failed
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// Kinds of UploadError, compare them with errors.Is to pick a response
+var (
+	// ErrFileTooBig is returned for uploads over a size limit: MaxFileSize, MaxDecompressedSize,
+	// MaxMediaDuration or the image dimensions. Respond with 413 Request Entity Too Large
+	ErrFileTooBig = errors.New("file too big")
+	// ErrDisallowedType is returned for files whose type, extension or content is not permitted,
+	// including executables and files that fail validation. Respond with 415 Unsupported Media Type
+	ErrDisallowedType = errors.New("disallowed file type")
+	// ErrTooManyFiles is returned when more files than MaxFileCount, or more parts than
+	// MaxUploadCount, are uploaded
+	ErrTooManyFiles = errors.New("too many files")
+)
+
+// UploadError is returned by the upload methods for files that break a limit. Error() reads like
+// the other upload errors, errors.Is matches the Kind and errors.As gives access to the context
+type UploadError struct {
+	Kind     error  // ErrFileTooBig, ErrDisallowedType or ErrTooManyFiles
+	FileName string // the original name of the file, empty when the error is not about a single file
+	Limit    int64  // the limit that was exceeded in its own unit (bytes, pixels, nanoseconds for durations), zero for disallowed types
+	message  string
+	cause    error
+}
+
+// Error() returns the message describing the broken limit
+func (e *UploadError) Error() string {
+	return e.message
+}
+
+// Unwrap() returns the Kind of the error, so errors.Is(err, ErrFileTooBig) works,
+// and the underlying error if there is one
+func (e *UploadError) Unwrap() []error {
+	if e.cause == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.cause}
+}
+
+// newUploadError builds an UploadError of the kind with a formatted message.
+// An error wrapped with %w in the format stays reachable through errors.Is and errors.As
+func newUploadError(kind error, fileName string, limit int64, format string, args ...any) *UploadError {
+	err := fmt.Errorf(format, args...)
+	return &UploadError{Kind: kind, FileName: fileName, Limit: limit, message: err.Error(), cause: errors.Unwrap(err)}
+}
+
+// checkIfMatch compares the If-Match header of the request with the ETags of the files the uploads
+// would replace. Nothing is checked when EnforceIfMatch is not set or the header is missing
+func (t *Tools) checkIfMatch(r *http.Request, uploadDir string, headers []*multipart.FileHeader) error {
+	ifMatch := strings.Join(r.Header.Values("If-Match"), ",")
+	if !t.EnforceIfMatch || ifMatch == "" {
+		return nil
+	}
+
+	for _, hdr := range headers {
+		name, err := t.keptFileName(hdr.Filename)
+		if err != nil {
+			return err
+		}
+		if t.CompressOnDisk {
+			name += ".gz"
+		}
+
+		// A file that does not exist yet has no ETag and never matches
+		etag, err := fileETag(filepath.Join(uploadDir, name))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if !ifMatchAllows(ifMatch, etag) {
+			return fmt.Errorf("%w: the file %s does not match If-Match", ErrPreconditionFailed, name)
+		}
+	}
+
+	return nil
+}
+
+// ifMatchAllows reports whether the If-Match header matches the ETag of the current file.
+// Weak tags never match, as If-Match requires the strong comparison
+func ifMatchAllows(ifMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// fileETag returns the ETag of a file, in the same format as ETag()
+func fileETag(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%q", hex.EncodeToString(digest.Sum(nil))), nil
+}
+
+// keptFileName returns the name a file is stored under when it is not renamed: the original
+// name without directories, made safe for the file system
+func (t *Tools) keptFileName(name string) (string, error) {
+	baseName, err := originalBaseName(name)
+	if err != nil {
+		return "", err
+	}
+	return t.SafeFileName(baseName)
+}
+
+// prepareUploadDir cleans the upload directory, rejects it if it lies outside of UploadRoot,
+// and creates it if it does not exist. Returns the cleaned directory
+func (t *Tools) prepareUploadDir(uploadDir string) (string, error) {
+	// Coalesce repeated slashes, drop trailing slashes and resolve ".." segments
+	cleaned := filepath.Clean(uploadDir)
+
+	if t.UploadRoot != "" {
+		root, err := filepath.Abs(t.UploadRoot)
+		if err != nil {
+			return "", err
+		}
+		dir, err := filepath.Abs(cleaned)
+		if err != nil {
+			return "", err
+		}
+
+		// The directory must be the root itself or below it
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("the upload directory %s is outside of %s", uploadDir, t.UploadRoot)
+		}
+	}
+
+	if err := t.CreateNewDirectory(cleaned); err != nil {
+		return "", err
+	}
+	return cleaned, nil
+}
+
+// partCountingReader counts the parts of a multipart body by their delimiters as the body is read,
+// and fails with an ErrTooManyFiles UploadError as soon as a part over the limit begins
+type partCountingReader struct {
+	io.ReadCloser
+	delimiter []byte // Line break, two dashes and the boundary
+	max       int
+	parts     int
+	tail      []byte // End of the data read so far, delimiters can span two reads
+}
+
+func (p *partCountingReader) Read(b []byte) (int, error) {
+	n, err := p.ReadCloser.Read(b)
+	if n == 0 {
+		return n, err
+	}
+
+	data := append(p.tail, b[:n]...)
+	pos := 0
+	for {
+		i := bytes.Index(data[pos:], p.delimiter)
+		if i == -1 {
+			// Keep enough bytes to find a delimiter split across reads
+			pos = max(pos, len(data)-len(p.delimiter)+1)
+			break
+		}
+		i += pos
+
+		// Two more bytes tell a new part apart from the closing delimiter
+		end := i + len(p.delimiter)
+		if end+2 > len(data) {
+			pos = i
+			break
+		}
+		if !bytes.Equal(data[end:end+2], []byte("--")) {
+			p.parts++
+			if p.parts > p.max {
+				return 0, newUploadError(ErrTooManyFiles, "", int64(p.max), "too many parts in the multipart request")
+			}
+		}
+		pos = end
+	}
+	p.tail = append([]byte(nil), data[pos:]...)
+
+	return n, err
+}
+
+// defaultMaxFileSize is the upload limit used when MaxFileSize is not set
+const defaultMaxFileSize = 1024 * 1024 * 1024
+
+// maxFileSize returns MaxFileSize, or the default limit if it is not set.
+// The default is not stored, concurrent uploads may share the Tools value
+func (t *Tools) maxFileSize() int {
+	if t.MaxFileSize == 0 {
+		return defaultMaxFileSize
+	}
+	return t.MaxFileSize
+}
+
+// parseUploadForm parses the multipart form of the request, limited by the max file size of the upload
+func (t *Tools) parseUploadForm(r *http.Request, limits uploadLimits) error {
+	// Count the parts while the body is parsed, to stop before reading all of them
+	if t.MaxUploadCount > 0 && r.MultipartForm == nil {
+		if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && params["boundary"] != "" {
+			r.Body = &partCountingReader{
+				ReadCloser: r.Body,
+				delimiter:  []byte("\r\n--" + params["boundary"]),
+				max:        t.MaxUploadCount,
+				// The first delimiter is not preceded by a line break, pretend it is
+				tail: []byte("\r\n"),
+			}
+		}
+	}
+
+	// Check for an error when parsing the request
+	err := r.ParseMultipartForm(int64(limits.maxFileSize))
+	if err != nil {
+		// Only size errors mean the upload is too big, anything else is a broken request
+		var maxBytesErr *http.MaxBytesError
+		if errors.Is(err, multipart.ErrMessageTooLarge) || errors.As(err, &maxBytesErr) {
+			return newUploadError(ErrFileTooBig, "", int64(limits.maxFileSize), "the uploaded file is too big")
+		}
+		var uploadErr *UploadError
+		if errors.As(err, &uploadErr) {
+			return uploadErr
+		}
+		return fmt.Errorf("malformed multipart request: %w", err)
+	}
+
+	return nil
+}
+
+// UploadTee copies the file uploaded under the given form field to every writer at once, for
+// example to store it on disk and forward it to another service. The file goes through the
+// same type and size checks as UploadFiles, but nothing is written to an upload directory.
+// Returns the metadata of the file, or an error naming the writer that failed
+func (t *Tools) UploadTee(r *http.Request, field string, writers ...io.Writer) (*UploadedFile, error) {
+	if len(writers) == 0 {
+		return nil, errors.New("no writers provided")
+	}
+
+	// Check the upload token when UploadTokenSecret is set, its fields may narrow the limits
+	limits, err := t.authorizeUpload(r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.parseUploadForm(r, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := r.MultipartForm.File[field]
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("no file uploaded in the form field %q", field)
+	}
+	hdr := headers[0]
+
+	infile, err := hdr.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer infile.Close()
+
+	if _, err := t.checkUploadedFile(hdr, infile, limits); err != nil {
+		return nil, err
+	}
+
+	// Label every writer so a failure can be traced back to it
+	tees := make([]io.Writer, len(writers))
+	for i, w := range writers {
+		tees[i] = &teeWriter{Writer: w, index: i}
+	}
+
+	// Copy one byte past the limit to detect files that are too big
+	fileSize, err := CopyRateLimited(io.MultiWriter(tees...), io.LimitReader(infile, int64(limits.maxFileSize)+1), t.uploadRateLimiter())
+	if err != nil {
+		return nil, err
+	}
+	if fileSize > int64(limits.maxFileSize) {
+		return nil, newUploadError(ErrFileTooBig, hdr.Filename, int64(limits.maxFileSize), "the uploaded file %s is bigger than %d bytes", hdr.Filename, limits.maxFileSize)
+	}
+
+	return &UploadedFile{
+		OriginalFileName: hdr.Filename,
+		FileSize:         fileSize,
+	}, nil
+}
+
+// teeWriter wraps one of the writers of UploadTee and reports its position on failure
+type teeWriter struct {
+	io.Writer
+	index int
+}
+
+// Write() writes to the wrapped writer, adding the index of the writer to errors
+func (tw *teeWriter) Write(p []byte) (int, error) {
+	n, err := tw.Writer.Write(p)
+	if err != nil {
+		return n, fmt.Errorf("writer %d failed: %w", tw.index, err)
+	}
+	return n, nil
+}
+
+// checkUploadedFile sniffs the type of an uploaded file and runs the configured checks on it,
+// within the limits of the upload, returning the detected type. The file is rewound to the beginning afterwards
+func (t *Tools) checkUploadedFile(hdr *multipart.FileHeader, infile multipart.File, limits uploadLimits) (string, error) {
+	// We need to look at the first 512 bytes to find out the type of file
+	buff := make([]byte, 512)
+	n, err := io.ReadFull(infile, buff) // Read the bytes
+	// Files shorter than 512 bytes, including empty ones, are fine
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	// Only sniff the bytes actually read, trailing zeros would look like binary content
+	buff = buff[:n]
+
+	// Check to see if the file type is permitted
+	// Assume that the file type is not allowed
+	allowed := false
+	fileType := http.DetectContentType(buff) // Get file type of the bytes
+
+	// Check if the AllowedFileTypes was populated, the upload token may have narrowed them
+	if len(limits.allowedTypes) > 0 {
+		for _, f := range limits.allowedTypes {
+			// If current file type equals one of the permitted file types...
+			if strings.EqualFold(fileType, f) {
+				// ...allow the file
+				allowed = true
+			}
+		}
+		// if AllowedFileTypes was not populated...
+	} else {
+		// ...allow all files
+		allowed = true
+	}
+
+	// If allowed is still false, return an error
+	if !allowed {
+		return "", newUploadError(ErrDisallowedType, hdr.Filename, 0, "the uploaded file type is not permitted")
+	}
+
+	// Check the magic numbers of executables, whatever the extension or type
+	if t.RejectExecutables {
+		if format := executableFormat(buff, infile); format != "" {
+			return "", newUploadError(ErrDisallowedType, hdr.Filename, 0, "the uploaded file %s is an executable (%s)", hdr.Filename, format)
+		}
+	}
+
+	// Check that the extension and the content agree with each other,
+	// StrictUploadValidation also requires the extension to be known
+	if t.StrictUploadValidation || t.ValidateExtension {
+		if err := t.validateExtension(hdr.Filename, fileType, t.StrictUploadValidation); err != nil {
+			return "", err
+		}
+	}
+
+	// Check the duration of audio and video files if a limit was set
+	// Formats other than MP3 and MP4 cannot be measured and are let through
+	if t.MaxMediaDuration > 0 && isMediaType(fileType) {
+		duration, err := mediaDuration(infile, hdr.Size)
+		if err != nil && err != errUnknownDuration {
+			return "", newUploadError(ErrDisallowedType, hdr.Filename, 0, "cannot determine the duration of %s: %w", hdr.Filename, err)
+		}
+		if duration > t.MaxMediaDuration {
+			return "", newUploadError(ErrFileTooBig, hdr.Filename, int64(t.MaxMediaDuration), "the uploaded file %s exceeds the maximum duration of %s", hdr.Filename, t.MaxMediaDuration)
+		}
+	}
+
+	// Check the dimensions of images if a limit was set
+	if (t.MaxImageWidth > 0 || t.MaxImageHeight > 0 || t.MaxImagePixels > 0) && strings.HasPrefix(fileType, "image/") {
+		if err := t.checkImageDimensions(infile, hdr.Filename); err != nil {
+			return "", err
+		}
+	}
+
+	// Check that JSON files parse before they are stored
+	if t.ValidateJSONUploads && isJSONFile(hdr.Filename, fileType) {
+		if err := t.validateJSONUpload(infile, hdr.Filename, limits.maxFileSize); err != nil {
+			return "", err
+		}
+	}
+
+	// Check that gzip files decompress cleanly and within the size cap
+	if t.ValidateGzip && isGzipFile(hdr.Filename, fileType) {
+		if err := t.validateGzipUpload(infile, hdr.Filename); err != nil {
+			return "", err
+		}
+	}
+
+	// Since we read the beginning of the file,
+	// We have to go back to the beginning of the file
+	_, err = infile.Seek(0, 0)
+	if err != nil {
+		return "", err
+	}
+
+	return fileType, nil
+}
+
+// saveUploadedFile checks a single file of the multipart form against the limits of the upload
+// and writes it to uploadDir
+func (t *Tools) saveUploadedFile(hdr *multipart.FileHeader, uploadDir string, renameFile bool, limits uploadLimits) (*UploadedFile, error) {
+	var uploadedFile UploadedFile
+	// Open the header
+	infile, err := hdr.Open()
+	if err != nil {
+		return nil, err
+	}
+	// Close in order to avoid resource leak
+	defer infile.Close()
+
+	// Run the type and content checks, the file is rewound afterwards
+	fileType, err := t.checkUploadedFile(hdr, infile, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	// The content written to disk, replaced by a cleaned copy for sanitized SVG files
+	var content io.Reader = infile
+	if t.SanitizeSVG && isSVGFile(hdr.Filename, fileType) {
+		sanitized, err := sanitizeSVG(infile)
+		if err != nil {
+			return nil, newUploadError(ErrDisallowedType, hdr.Filename, 0, "the uploaded file %s is not a valid SVG image: %w", hdr.Filename, err)
+		}
+		content = bytes.NewReader(sanitized)
+	} else if t.TranscodeToUTF8 && isTextType(fileType) {
+		// Convert text in other charsets to UTF-8 on the way to disk
+		charset, err := detectCharset(infile)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = infile.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		uploadedFile.Charset = charset
+		if decoder := charsetDecoder(charset); decoder != nil {
+			content = decoder.Reader(infile)
+		}
+	}
+
+	// Convert the line endings of text files, UTF-16 only once it was transcoded
+	if t.NormalizeTextUploads.bytes() != nil && isTextType(fileType) && (t.TranscodeToUTF8 || !strings.Contains(fileType, "utf-16")) {
+		content = transform.NewReader(content, lineEndingTransformer{ending: t.NormalizeTextUploads.bytes()})
+	}
+
+	// If its going to be renamed - generate a new name with original extension
+	if renameFile {
+		uploadedFile.NewFileName = fmt.Sprintf("%s%s", t.RandomString(25), filepath.Ext(hdr.Filename))
+	} else {
+		keptName, err := t.keptFileName(hdr.Filename)
+		if err != nil {
+			return nil, err
+		}
+		uploadedFile.NewFileName = keptName
+	}
+
+	uploadedFile.OriginalFileName = hdr.Filename
+
+	// Compressed files are marked with the .gz extension
+	if t.CompressOnDisk {
+		uploadedFile.NewFileName += ".gz"
+	}
+
+	// Never write outside of the upload directory
+	filePath := filepath.Join(uploadDir, uploadedFile.NewFileName)
+	if rel, err := filepath.Rel(uploadDir, filePath); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("the file name %q resolves outside of the upload directory", hdr.Filename)
+	}
+
+	// Save to disk, creating the file we will write to in the provided directory
+	outfile, err := t.createUploadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	// A different name may have been picked to avoid overwriting a file
+	uploadedFile.NewFileName = filepath.Base(outfile.Name())
+	// Only close the file once it was actually created
+	defer outfile.Close()
+
+	// Hash the content while it is written, instead of reading the file again
+	var digest hash.Hash
+	if t.ComputeChecksum {
+		digest = sha256.New()
+	}
+
+	// Copy one byte past the limit to detect files that are too big
+	fileSize, uncompressedSize, err := t.writeUpload(outfile, io.LimitReader(content, int64(limits.maxFileSize)+1), digest)
+	if err == nil && uncompressedSize > int64(limits.maxFileSize) {
+		err = newUploadError(ErrFileTooBig, hdr.Filename, int64(limits.maxFileSize), "the uploaded file %s is bigger than %d bytes", hdr.Filename, limits.maxFileSize)
+	}
+	if err != nil {
+		// Do not leave an incomplete file behind
+		t.removePartialFile(outfile)
+		return nil, err
+	}
+
+	uploadedFile.FileSize = fileSize
+	uploadedFile.UncompressedSize = uncompressedSize
+	if digest != nil {
+		uploadedFile.Checksum = hex.EncodeToString(digest.Sum(nil))
+	}
+
+	return &uploadedFile, nil
+}
+
+// maxRenameAttempts bounds the suffixes tried by OverwriteRename
+const maxRenameAttempts = 10000
+
+// createUploadFile creates the file an upload is written to, following OverwriteBehavior when it exists.
+// Existing files are detected when the file is created, so concurrent uploads cannot replace each other
+func (t *Tools) createUploadFile(filePath string) (*os.File, error) {
+	if t.OverwriteBehavior == Overwrite {
+		return os.Create(filePath)
+	}
+
+	// Only create the file if it does not exist yet
+	const flags = os.O_RDWR | os.O_CREATE | os.O_EXCL
+	file, err := os.OpenFile(filePath, flags, 0666)
+	if !os.IsExist(err) {
+		return file, err
+	}
+	if t.OverwriteBehavior == OverwriteError {
+		return nil, fmt.Errorf("the file %s already exists", filepath.Base(filePath))
+	}
+
+	// Try name-1.ext, name-2.ext and so on
+	ext := filepath.Ext(filePath)
+	base := strings.TrimSuffix(filePath, ext)
+	for i := 1; i <= maxRenameAttempts; i++ {
+		file, err = os.OpenFile(fmt.Sprintf("%s-%d%s", base, i, ext), flags, 0666)
+		if !os.IsExist(err) {
+			return file, err
+		}
+	}
+	return nil, fmt.Errorf("cannot find a free name for %s", filepath.Base(filePath))
+}
+
+// writeUpload copies the uploaded file to disk, through gzip if CompressOnDisk is set.
+// The original content is also written to digest, unless it is nil.
+// Returns the number of bytes stored on disk and the size of the original file
+func (t *Tools) writeUpload(outfile *os.File, infile io.Reader, digest hash.Hash) (int64, int64, error) {
+	if !t.CompressOnDisk {
+		var dst io.Writer = outfile
+		if digest != nil {
+			dst = io.MultiWriter(outfile, digest)
+		}
+		n, err := CopyRateLimited(dst, infile, t.uploadRateLimiter())
+		return n, n, err
+	}
+
+	gz := gzip.NewWriter(outfile)
+	var dst io.Writer = gz
+	if digest != nil {
+		dst = io.MultiWriter(gz, digest)
+	}
+	uncompressed, err := CopyRateLimited(dst, infile, t.uploadRateLimiter())
+	if err != nil {
+		return 0, 0, err
+	}
+	// Flush the remaining compressed data and the gzip footer
+	if err = gz.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	info, err := outfile.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	return info.Size(), uncompressed, nil
+}
+
+// gzipReadCloser closes both the gzip reader and the underlying file
+type gzipReadCloser struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// OpenUploaded opens a stored upload for reading. Files stored with
+// CompressOnDisk, recognized by their .gz extension, are transparently decompressed
+func (t *Tools) OpenUploaded(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(filepath.Ext(path), ".gz") {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &gzipReadCloser{Reader: gz, file: file}, nil
+}
+
+// executableMagic maps the magic numbers of executable formats to their names
+var executableMagic = []struct {
+	magic  []byte
+	format string
+}{
+	{[]byte("\x7fELF"), "ELF"},
+	{[]byte{0xFE, 0xED, 0xFA, 0xCE}, "Mach-O"},
+	{[]byte{0xFE, 0xED, 0xFA, 0xCF}, "Mach-O"},
+	{[]byte{0xCE, 0xFA, 0xED, 0xFE}, "Mach-O"},
+	{[]byte{0xCF, 0xFA, 0xED, 0xFE}, "Mach-O"},
+	{[]byte{0xCA, 0xFE, 0xBA, 0xBE}, "Mach-O universal"},
+	{[]byte("#!"), "shebang script"},
+}
+
+// executableFormat returns the name of the executable format the file starts with,
+// or an empty string if it is not an executable
+func executableFormat(head []byte, file io.ReaderAt) string {
+	for _, e := range executableMagic {
+		if bytes.HasPrefix(head, e.magic) {
+			return e.format
+		}
+	}
+	if isPE(head, file) {
+		return "PE"
+	}
+	return ""
+}
+
+// isPE reports whether the file is a Windows PE executable. "MZ" alone is too common a start,
+// e.g. for text files, so the PE signature is looked up at the offset the DOS header points to
+func isPE(head []byte, file io.ReaderAt) bool {
+	// The DOS header is 64 bytes, it ends with e_lfanew, the offset of the PE header
+	if len(head) < 0x40 || !bytes.HasPrefix(head, []byte("MZ")) {
+		return false
+	}
+	offset := binary.LittleEndian.Uint32(head[0x3C:0x40])
+
+	signature := make([]byte, 4)
+	if _, err := file.ReadAt(signature, int64(offset)); err != nil {
+		return false
+	}
+	return bytes.Equal(signature, []byte("PE\x00\x00"))
+}
+
+// checkImageDimensions reads the dimensions from the image header, without decoding the pixels,
+// and checks them against MaxImageWidth, MaxImageHeight and MaxImagePixels.
+// Formats without a registered decoder, such as WebP, are let through
+func (t *Tools) checkImageDimensions(infile io.ReadSeeker, fileName string) error {
+	if _, err := infile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	config, _, err := image.DecodeConfig(infile)
+	if errors.Is(err, image.ErrFormat) {
+		return nil
+	}
+	if err != nil {
+		return newUploadError(ErrDisallowedType, fileName, 0, "cannot read the dimensions of %s: %w", fileName, err)
+	}
+
+	switch {
+	case t.MaxImageWidth > 0 && config.Width > t.MaxImageWidth:
+		return newUploadError(ErrFileTooBig, fileName, int64(t.MaxImageWidth), "the uploaded image %s is %d pixels wide, the maximum width is %d", fileName, config.Width, t.MaxImageWidth)
+	case t.MaxImageHeight > 0 && config.Height > t.MaxImageHeight:
+		return newUploadError(ErrFileTooBig, fileName, int64(t.MaxImageHeight), "the uploaded image %s is %d pixels high, the maximum height is %d", fileName, config.Height, t.MaxImageHeight)
+	case t.MaxImagePixels > 0 && int64(config.Width)*int64(config.Height) > t.MaxImagePixels:
+		return newUploadError(ErrFileTooBig, fileName, t.MaxImagePixels, "the uploaded image %s has %d pixels, the maximum is %d", fileName, int64(config.Width)*int64(config.Height), t.MaxImagePixels)
+	}
+	return nil
+}
+
+// isJSONFile reports whether the file is JSON by its extension or detected type
+func isJSONFile(fileName, fileType string) bool {
+	return strings.EqualFold(filepath.Ext(fileName), ".json") || strings.HasPrefix(fileType, "application/json")
+}
+
+// validateJSONUpload reads the whole file, bounded by maxSize, and checks that it is valid JSON
+func (t *Tools) validateJSONUpload(infile io.ReadSeeker, fileName string, maxSize int) error {
+	if _, err := infile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Read one byte past the limit to detect oversized files
+	content, err := io.ReadAll(io.LimitReader(infile, int64(maxSize)+1))
+	if err != nil {
+		return err
+	}
+	if len(content) > maxSize {
+		return newUploadError(ErrFileTooBig, fileName, int64(maxSize), "the uploaded file %s is too big to be validated", fileName)
+	}
+
+	if !json.Valid(content) {
+		return newUploadError(ErrDisallowedType, fileName, 0, "the uploaded file %s is not valid JSON", fileName)
+	}
+	return nil
+}
+
+// defaultMaxDecompressedSize is used when MaxDecompressedSize is not set
+const defaultMaxDecompressedSize = 1024 * 1024 * 1024
+
+// isGzipFile reports whether the file is gzip compressed by its extension or detected type
+func isGzipFile(fileName, fileType string) bool {
+	return strings.EqualFold(filepath.Ext(fileName), ".gz") || fileType == "application/x-gzip"
+}
+
+// validateGzipUpload decompresses the whole file without keeping the output, and checks that
+// it is a valid gzip archive that does not expand beyond MaxDecompressedSize
+func (t *Tools) validateGzipUpload(infile io.ReadSeeker, fileName string) error {
+	if _, err := infile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	maxSize := t.MaxDecompressedSize
+	if maxSize == 0 {
+		maxSize = defaultMaxDecompressedSize
+	}
+
+	gz, err := gzip.NewReader(infile)
+	if err != nil {
+		return newUploadError(ErrDisallowedType, fileName, 0, "the uploaded file %s is not a valid gzip archive: %w", fileName, err)
+	}
+	defer gz.Close()
+
+	// Read one byte past the cap to detect decompression bombs
+	n, err := io.Copy(io.Discard, io.LimitReader(gz, int64(maxSize)+1))
+	if err != nil {
+		return newUploadError(ErrDisallowedType, fileName, 0, "the uploaded file %s is not a valid gzip archive: %w", fileName, err)
+	}
+	if n > int64(maxSize) {
+		return newUploadError(ErrFileTooBig, fileName, int64(maxSize), "the uploaded file %s decompresses to more than %d bytes", fileName, maxSize)
+	}
+	return nil
+}
+
+// removePartialFile closes and deletes a file whose upload did not complete, unless
+// CleanupOnError is set to false. Files that were fully written are never removed
+func (t *Tools) removePartialFile(f *os.File) {
+	if t.CleanupOnError != nil && !*t.CleanupOnError {
+		return
+	}
+
+	f.Close()
+	os.Remove(f.Name())
+}
@@ -1,6 +1,10 @@
 package toolkit
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"image"
 	"image/png"
@@ -9,11 +13,47 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
+// testFile describes a file sent by newUploadRequest
+type testFile struct {
+	field   string
+	name    string
+	content []byte
+}
+
+// newUploadRequest builds a multipart request carrying the provided files
+func newUploadRequest(t *testing.T, files ...testFile) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	mpWriter := multipart.NewWriter(body)
+	for _, f := range files {
+		part, err := mpWriter.CreateFormFile(f.field, f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = part.Write(f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mpWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Add("Content-Type", mpWriter.FormDataContentType())
+	return req
+}
+
 var uploadTests = []struct {
 	name          string
 	allowedTypes  []string
@@ -191,3 +231,1434 @@ func TestTools_UploadOneFile(t *testing.T) {
 
 	}
 }
+
+// mp4Box encodes an MP4 box with the provided type and payload
+func mp4Box(boxType string, payload ...[]byte) []byte {
+	content := bytes.Join(payload, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(content)))
+	return append(append(box, boxType...), content...)
+}
+
+// syntheticMP4 builds a minimal MP4 file with the provided duration
+func syntheticMP4(d time.Duration) []byte {
+	const timescale = 1000
+	ftyp := mp4Box("ftyp", []byte("mp42"), make([]byte, 4), []byte("mp42isom"))
+	// version, flags, creation time, modification time, timescale, duration
+	mvhd := make([]byte, 20)
+	binary.BigEndian.PutUint32(mvhd[12:16], timescale)
+	binary.BigEndian.PutUint32(mvhd[16:20], uint32(d.Milliseconds()))
+	return append(ftyp, mp4Box("moov", mp4Box("mvhd", mvhd, make([]byte, 80)))...)
+}
+
+// syntheticMP3 builds a constant bitrate 128kbps MP3 file with the provided duration
+func syntheticMP3(d time.Duration) []byte {
+	// ID3v2.3 tag without frames
+	file := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 0}
+	// MPEG1 layer III, 128kbps, 44.1kHz, no padding: 417 bytes per frame
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x64})
+	for size := int64(0); size < int64(d.Seconds()*128000/8); size += int64(len(frame)) {
+		file = append(file, frame...)
+	}
+	return file
+}
+
+func TestTools_UploadFiles_MaxMediaDuration(t *testing.T) {
+	tests := []struct {
+		name          string
+		fileName      string
+		content       []byte
+		errorExpected bool
+	}{
+		{"Short MP4", "short.mp4", syntheticMP4(5 * time.Second), false},
+		{"Long MP4", "long.mp4", syntheticMP4(2 * time.Minute), true},
+		{"Short MP3", "short.mp3", syntheticMP3(5 * time.Second), false},
+		{"Long MP3", "long.mp3", syntheticMP3(90 * time.Second), true},
+		{"Not a media file", "notes.txt", []byte("hello, world"), false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{MaxMediaDuration: time.Minute}
+			req := newUploadRequest(t, testFile{"file", entry.fileName, entry.content})
+
+			_, err := tools.UploadFiles(req, t.TempDir(), false)
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but none received")
+			}
+
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %+v", err)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_StrictUploadValidation(t *testing.T) {
+	png, err := os.ReadFile("./testdata/img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf := []byte("%PDF-1.4\n%âãÏÓ\n1 0 obj\n<<>>\nendobj\n")
+
+	tests := []struct {
+		name          string
+		fileName      string
+		content       []byte
+		table         map[string][]string
+		errorExpected bool
+	}{
+		{"Consistent pair", "img.png", png, nil, false},
+		{"Uppercase extension", "IMG.PNG", png, nil, false},
+		{"PDF content with png extension", "img.png", pdf, nil, true},
+		{"PNG content with pdf extension", "doc.pdf", png, nil, true},
+		{"Unknown extension", "img.xyz", png, nil, true},
+		{"Custom table", "img.xyz", png, map[string][]string{".xyz": {"image/png"}}, false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{StrictUploadValidation: true, ExtensionMimeTable: entry.table}
+			req := newUploadRequest(t, testFile{"file", entry.fileName, entry.content})
+
+			_, err := tools.UploadFiles(req, t.TempDir(), false)
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but none received")
+			}
+
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %+v", err)
+			}
+		})
+	}
+}
+
+func TestTools_FileURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		baseURL     string
+		newFileName string
+		expected    string
+	}{
+		{"Plain base URL", "https://cdn.example.com/uploads", "abc.png", "https://cdn.example.com/uploads/abc.png"},
+		{"Trailing slash", "https://cdn.example.com/uploads/", "abc.png", "https://cdn.example.com/uploads/abc.png"},
+		{"Multiple trailing slashes", "https://cdn.example.com//", "abc.png", "https://cdn.example.com/abc.png"},
+		{"Date partitioned name", "https://cdn.example.com/uploads", "2024/05/17/abc.png", "https://cdn.example.com/uploads/2024/05/17/abc.png"},
+		{"Escaped name", "https://cdn.example.com", "my photo?.png", "https://cdn.example.com/my%20photo%3F.png"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{PublicBaseURL: entry.baseURL}
+
+			result := tools.FileURL(&UploadedFile{NewFileName: entry.newFileName})
+			if result != entry.expected {
+				t.Errorf("expected %s, but received %s", entry.expected, result)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_RemovesPartialFiles(t *testing.T) {
+	// Writes to /dev/full always fail, which forces the copy to fail
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full is not available")
+	}
+
+	enabled, disabled := true, false
+	tests := []struct {
+		name           string
+		cleanupOnError *bool
+		expectRemoved  bool
+	}{
+		{"Partial file is removed by default", nil, true},
+		{"Partial file is removed", &enabled, true},
+		{"Partial file is kept", &disabled, false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			uploadDir := t.TempDir()
+			target := filepath.Join(uploadDir, "notes.txt")
+			if err := os.Symlink("/dev/full", target); err != nil {
+				t.Fatal(err)
+			}
+
+			tools := Tools{CleanupOnError: entry.cleanupOnError}
+			req := newUploadRequest(t, testFile{"file", "notes.txt", []byte("hello, world")})
+
+			_, err := tools.UploadFiles(req, uploadDir, false)
+			if err == nil {
+				t.Fatal("expected an error, but none received")
+			}
+
+			_, err = os.Lstat(target)
+			if !entry.expectRemoved && err != nil {
+				t.Errorf("expected the partial file to be kept, but received %+v", err)
+			}
+
+			if entry.expectRemoved && !os.IsNotExist(err) {
+				t.Error("expected the partial file to be removed")
+			}
+		})
+	}
+}
+
+func TestTools_UploadFilesByField(t *testing.T) {
+	tests := []struct {
+		name          string
+		ignore        bool
+		errorExpected bool
+	}{
+		{"Unmapped field is rejected", false, true},
+		{"Unmapped field is ignored", true, false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			avatars, documents := t.TempDir(), t.TempDir()
+			tools := Tools{IgnoreUnmappedFields: entry.ignore}
+			req := newUploadRequest(t,
+				testFile{"avatars", "me.txt", []byte("avatar")},
+				testFile{"documents", "cv.txt", []byte("document")},
+				testFile{"documents", "letter.txt", []byte("letter")},
+				testFile{"other", "other.txt", []byte("other")},
+			)
+
+			uploaded, err := tools.UploadFilesByField(req, map[string]string{"avatars": avatars, "documents": documents}, false)
+
+			if entry.errorExpected {
+				if err == nil {
+					t.Error("expected an error, but none received")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, but received %+v", err)
+			}
+
+			if len(uploaded["avatars"]) != 1 || len(uploaded["documents"]) != 2 || len(uploaded["other"]) != 0 {
+				t.Errorf("unexpected grouping of uploaded files: %v", uploaded)
+			}
+
+			for dir, names := range map[string][]string{avatars: {"me.txt"}, documents: {"cv.txt", "letter.txt"}} {
+				for _, name := range names {
+					if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+						t.Errorf("expected %s to be placed in %s: %+v", name, dir, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_ValidateJSONUploads(t *testing.T) {
+	tests := []struct {
+		name          string
+		fileName      string
+		content       string
+		errorExpected bool
+	}{
+		{"Valid JSON", "config.json", `{"debug": true, "ports": [80, 443]}`, false},
+		{"Malformed JSON", "config.json", `{"debug": true,`, true},
+		{"Uppercase extension", "CONFIG.JSON", `{"debug": `, true},
+		{"Not a JSON file", "notes.txt", `{"debug": `, false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{ValidateJSONUploads: true}
+			req := newUploadRequest(t, testFile{"file", entry.fileName, []byte(entry.content)})
+
+			uploaded, err := tools.UploadFiles(req, t.TempDir(), false)
+
+			if entry.errorExpected {
+				if err == nil || !strings.Contains(err.Error(), entry.fileName) {
+					t.Errorf("expected an error naming %s, but received %v", entry.fileName, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, but received %+v", err)
+			}
+
+			// The whole file is stored after validation
+			if uploaded[0].FileSize != int64(len(entry.content)) {
+				t.Errorf("expected %d bytes to be stored, but received %d", len(entry.content), uploaded[0].FileSize)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_CompressOnDisk(t *testing.T) {
+	content := bytes.Repeat([]byte("hello, world\n"), 1000)
+	uploadDir := t.TempDir()
+	tools := Tools{CompressOnDisk: true}
+	req := newUploadRequest(t, testFile{"file", "notes.txt", content})
+
+	uploaded, err := tools.UploadFiles(req, uploadDir, false)
+	if err != nil {
+		t.Fatalf("expected no error, but received %+v", err)
+	}
+
+	file := uploaded[0]
+	if file.NewFileName != "notes.txt.gz" {
+		t.Errorf("expected notes.txt.gz, but received %s", file.NewFileName)
+	}
+
+	if file.UncompressedSize != int64(len(content)) {
+		t.Errorf("expected uncompressed size %d, but received %d", len(content), file.UncompressedSize)
+	}
+
+	info, err := os.Stat(filepath.Join(uploadDir, file.NewFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.FileSize != info.Size() || file.FileSize >= file.UncompressedSize {
+		t.Errorf("expected compressed size %d on disk, but received %d", info.Size(), file.FileSize)
+	}
+
+	// The stored file round-trips through OpenUploaded
+	reader, err := tools.OpenUploaded(filepath.Join(uploadDir, file.NewFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, content) {
+		t.Error("expected the decompressed file to match the original")
+	}
+}
+
+func TestTools_SafeFileName(t *testing.T) {
+	tests := []struct {
+		name          string
+		fileName      string
+		expected      string
+		errorExpected bool
+	}{
+		{"Regular name", "report.pdf", "report.pdf", false},
+		{"Reserved device name", "CON.txt", "CON_.txt", false},
+		{"Reserved name in lowercase", "nul", "nul_", false},
+		{"Reserved name with several extensions", "aux.tar.gz", "aux.tar_.gz", false},
+		{"Name containing reserved name", "CONTACTS.txt", "CONTACTS.txt", false},
+		{"Colon and slashes", "a:b/c\\d.txt", "abcd.txt", false},
+		{"Trailing dots and spaces", "notes.txt. . ", "notes.txt", false},
+		{"Dot file", ".env", ".env", false},
+		{"Long name keeps extension", strings.Repeat("a", 300) + ".png", strings.Repeat("a", 251) + ".png", false},
+		{"Only dots", "...", "", true},
+		{"Only illegal characters", "<>|", "", true},
+	}
+
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			safeName, err := tools.SafeFileName(entry.fileName)
+			if entry.errorExpected && err == nil {
+				t.Errorf("expected an error, but received %s", safeName)
+			}
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %v", err)
+			}
+			if safeName != entry.expected {
+				t.Errorf("expected %s, but received %s", entry.expected, safeName)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_SafeFileName(t *testing.T) {
+	var tools Tools
+	uploadDir := t.TempDir()
+
+	req := newUploadRequest(t, testFile{"file", "CON.txt", []byte("hello")})
+	files, err := tools.UploadFiles(req, uploadDir, false)
+	if err != nil {
+		t.Fatal("expected no error, but received", err)
+	}
+
+	if files[0].NewFileName != "CON_.txt" {
+		t.Errorf("expected new file name CON_.txt, but received %s", files[0].NewFileName)
+	}
+
+	if files[0].OriginalFileName != "CON.txt" {
+		t.Errorf("expected original file name CON.txt, but received %s", files[0].OriginalFileName)
+	}
+
+	if _, err := os.Stat(filepath.Join(uploadDir, "CON_.txt")); err != nil {
+		t.Error("expected the file to be stored:", err)
+	}
+}
+
+func TestTools_UploadFiles_MalformedRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		bodyLimit   int64
+		expected    string
+	}{
+		{"Not multipart", "application/json", "{}", 0, "malformed multipart request: request Content-Type isn't multipart/form-data"},
+		{"Missing boundary", "multipart/form-data", "", 0, "malformed multipart request: no multipart boundary param in Content-Type"},
+		{"Truncated body", "multipart/form-data; boundary=xyz", "--xyz\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\nhello", 0, "malformed multipart request: "},
+		{"Body over the server limit", "multipart/form-data; boundary=xyz", strings.Repeat("a", 100), 10, "the uploaded file is too big"},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(entry.body))
+			req.Header.Set("Content-Type", entry.contentType)
+			if entry.bodyLimit > 0 {
+				req.Body = http.MaxBytesReader(httptest.NewRecorder(), req.Body, entry.bodyLimit)
+			}
+
+			_, err := tools.UploadFiles(req, t.TempDir())
+			if err == nil {
+				t.Fatal("expected an error, but received none")
+			}
+
+			if !strings.HasPrefix(err.Error(), entry.expected) {
+				t.Errorf("expected error %q, but received %q", entry.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_SanitizeSVG(t *testing.T) {
+	const svg = `<?xml version="1.0"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" onload="alert(1)">
+  <script type="text/javascript"><![CDATA[alert(document.cookie)]]></script>
+  <a xlink:href=" JavaScript:alert(2)"><circle r="10" onclick="alert(3)"/></a>
+  <a href="https://example.com"><text>link</text></a>
+</svg>`
+
+	tests := []struct {
+		name          string
+		content       string
+		errorExpected bool
+		removed       []string
+		kept          []string
+	}{
+		{
+			name:    "Scripts are removed",
+			content: svg,
+			removed: []string{"script", "alert", "onload", "onclick", "JavaScript:"},
+			kept:    []string{`<circle r="10">`, `xmlns:xlink="http://www.w3.org/1999/xlink"`, `<a href="https://example.com">`},
+		},
+		{
+			name:    "Set animating a link",
+			content: `<svg xmlns="http://www.w3.org/2000/svg"><a><set attributeName="href" to="javascript:alert(1)"/><text>click</text></a></svg>`,
+			removed: []string{"<set", "javascript:"},
+			kept:    []string{"<text>click</text>"},
+		},
+		{
+			name:    "Animate with script values",
+			content: `<svg xmlns="http://www.w3.org/2000/svg"><a><animate attributeName="xlink:href" values="https://example.com;javascript:alert(1)"/></a><animateTransform attributeName="transform" values="javascript:alert(2)"/></svg>`,
+			removed: []string{"<animate", "javascript:"},
+		},
+		{
+			name:    "Harmless animation",
+			content: `<svg xmlns="http://www.w3.org/2000/svg"><circle r="10"><animate attributeName="r" from="10" to="20" dur="1s"/></circle></svg>`,
+			kept:    []string{`<animate attributeName="r" from="10" to="20" dur="1s">`},
+		},
+		{
+			name:    "ForeignObject with an iframe",
+			content: `<svg xmlns="http://www.w3.org/2000/svg"><foreignObject width="100" height="100"><iframe xmlns="http://www.w3.org/1999/xhtml" src="data:text/html,&lt;script&gt;alert(1)&lt;/script&gt;"></iframe></foreignObject><circle r="5"/></svg>`,
+			removed: []string{"foreignObject", "iframe", "data:"},
+			kept:    []string{`<circle r="5">`},
+		},
+		{
+			name:    "Data links",
+			content: `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><a href="data:text/html;base64,PHNjcmlwdD4="><text>x</text></a><a xlink:href=" DATA:image/svg+xml,x"/><image href="data:image/png;base64,iVBORw0KGgo="/></svg>`,
+			removed: []string{"data:text/html", "DATA:image/svg+xml"},
+			kept:    []string{`<image href="data:image/png;base64,iVBORw0KGgo=">`},
+		},
+		{
+			name:          "Malformed XML is rejected",
+			content:       `<svg xmlns="http://www.w3.org/2000/svg"><circle></svg>`,
+			errorExpected: true,
+		},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{SanitizeSVG: true}
+			uploadDir := t.TempDir()
+
+			req := newUploadRequest(t, testFile{"file", "image.svg", []byte(entry.content)})
+			files, err := tools.UploadFiles(req, uploadDir)
+
+			if entry.errorExpected {
+				if err == nil {
+					t.Error("expected an error, but received none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			stored, err := os.ReadFile(filepath.Join(uploadDir, files[0].NewFileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, s := range entry.removed {
+				if strings.Contains(string(stored), s) {
+					t.Errorf("expected %q to be removed from %s", s, stored)
+				}
+			}
+			for _, s := range entry.kept {
+				if !strings.Contains(string(stored), s) {
+					t.Errorf("expected %q to be kept in %s", s, stored)
+				}
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_UploadRoot(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		name          string
+		uploadDir     string
+		expectedDir   string
+		errorExpected bool
+	}{
+		{"Root itself", root, root, false},
+		{"Nested directory with repeated slashes", root + "//images///2024/", filepath.Join(root, "images", "2024"), false},
+		{"Dot segments inside the root", root + "/images/../docs", filepath.Join(root, "docs"), false},
+		{"Escaping with dot segments", root + "/../escape", "", true},
+		{"Absolute path outside the root", t.TempDir(), "", true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{UploadRoot: root}
+			req := newUploadRequest(t, testFile{"file", "notes.txt", []byte("hello")})
+
+			files, err := tools.UploadFiles(req, entry.uploadDir)
+
+			if entry.errorExpected {
+				if err == nil {
+					t.Error("expected an error, but received none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			// The directory is created and the file is stored in it
+			if _, err := os.Stat(filepath.Join(entry.expectedDir, files[0].NewFileName)); err != nil {
+				t.Errorf("expected the file to be stored in %s: %v", entry.expectedDir, err)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_CreateFails(t *testing.T) {
+	var tools Tools
+	uploadDir := t.TempDir()
+
+	// A directory with the name of the file makes os.Create fail, even when running as root
+	if err := os.Mkdir(filepath.Join(uploadDir, "notes.txt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("expected no panic, but received", r)
+		}
+	}()
+
+	req := newUploadRequest(t, testFile{"file", "notes.txt", []byte("hello")})
+	files, err := tools.UploadFiles(req, uploadDir, false)
+
+	if err == nil {
+		t.Error("expected an error, but received none")
+	}
+
+	if len(files) != 0 {
+		t.Errorf("expected no uploaded files, but received %d", len(files))
+	}
+}
+
+// gzipBytes compresses the content in memory
+func gzipBytes(t *testing.T, content []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTools_UploadFiles_ValidateGzip(t *testing.T) {
+	valid := gzipBytes(t, []byte("hello, world"))
+	// Cut off the footer, which holds the checksum
+	corrupt := valid[:len(valid)-6]
+	// A megabyte of zeros compresses to about a kilobyte
+	bomb := gzipBytes(t, make([]byte, 1024*1024))
+
+	tests := []struct {
+		name          string
+		content       []byte
+		errorExpected bool
+	}{
+		{"Valid archive", valid, false},
+		{"Corrupt archive", corrupt, true},
+		{"Not an archive", []byte("plain text"), true},
+		{"Decompression bomb", bomb, true},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{ValidateGzip: true, MaxDecompressedSize: 64 * 1024}
+			req := newUploadRequest(t, testFile{"file", "archive.gz", entry.content})
+
+			files, err := tools.UploadFiles(req, t.TempDir())
+
+			if entry.errorExpected && err == nil {
+				t.Error("expected an error, but received none")
+			}
+
+			if !entry.errorExpected && (err != nil || len(files) != 1) {
+				t.Errorf("expected one uploaded file, but received %d and error %v", len(files), err)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_MaxFileCount(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         int
+		errorExpected bool
+	}{
+		{"Under the limit", 2, false},
+		{"At the limit", 3, false},
+		{"Over the limit", 4, true},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{MaxFileCount: 3}
+
+			var files []testFile
+			for i := 0; i < entry.files; i++ {
+				files = append(files, testFile{"file", fmt.Sprintf("file-%d.txt", i), []byte("hello")})
+			}
+			uploadDir := t.TempDir()
+
+			uploaded, err := tools.UploadFiles(newUploadRequest(t, files...), uploadDir)
+
+			if entry.errorExpected {
+				if err == nil || err.Error() != "too many files uploaded" {
+					t.Errorf("expected error %q, but received %v", "too many files uploaded", err)
+				}
+			} else if err != nil {
+				t.Errorf("expected no error, but received %v", err)
+			}
+
+			// An upload over the limit stores none of its files
+			expectedStored := entry.files
+			if entry.errorExpected {
+				expectedStored = 0
+			}
+			if stored, _ := tools.CountFiles(uploadDir, ""); stored != expectedStored || len(uploaded) != expectedStored {
+				t.Errorf("expected %d stored files, but received %d", expectedStored, stored)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_TranscodeToUTF8(t *testing.T) {
+	// "Grüße, café" in different charsets
+	const expected = "Grüße, café"
+	latin1 := []byte("Gr\xfc\xdfe, caf\xe9")
+	utf16le := []byte{0xFF, 0xFE}
+	for _, r := range expected {
+		utf16le = append(utf16le, byte(r), byte(r>>8))
+	}
+	// Place a two byte rune across the boundary of the chunks read by detectCharset
+	longUTF8 := strings.Repeat("a", 32*1024-1) + expected
+
+	tests := []struct {
+		name            string
+		content         []byte
+		expectedContent string
+		expectedCharset string
+	}{
+		{"Latin-1", latin1, expected, "iso-8859-1"},
+		{"UTF-16 with byte order mark", utf16le, expected, "utf-16le"},
+		{"UTF-8 is kept", []byte(expected), expected, "utf-8"},
+		{"UTF-8 rune across chunks", []byte(longUTF8), longUTF8, "utf-8"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{TranscodeToUTF8: true}
+			uploadDir := t.TempDir()
+
+			files, err := tools.UploadFiles(newUploadRequest(t, testFile{"file", "notes.txt", entry.content}), uploadDir)
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			if files[0].Charset != entry.expectedCharset {
+				t.Errorf("expected charset %s, but received %s", entry.expectedCharset, files[0].Charset)
+			}
+
+			stored, err := os.ReadFile(filepath.Join(uploadDir, files[0].NewFileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !utf8.Valid(stored) {
+				t.Error("expected the stored file to be valid UTF-8")
+			}
+
+			if string(stored) != entry.expectedContent {
+				t.Errorf("expected content %q, but received %q", entry.expectedContent, stored)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_PerFileMaxFileSize(t *testing.T) {
+	tools := Tools{MaxFileSize: 100}
+	uploadDir := t.TempDir()
+
+	req := newUploadRequest(t,
+		testFile{"file", "first.txt", []byte("small")},
+		testFile{"file", "second.txt", []byte("also small")},
+		testFile{"file", "big.txt", bytes.Repeat([]byte("a"), 101)},
+		testFile{"file", "last.txt", []byte("never reached")},
+	)
+	files, err := tools.UploadFiles(req, uploadDir, false)
+
+	if err == nil || !strings.Contains(err.Error(), "big.txt") {
+		t.Errorf("expected an error naming big.txt, but received %v", err)
+	}
+
+	// The files uploaded before the oversized one are still reported
+	if len(files) != 2 || files[0].OriginalFileName != "first.txt" || files[1].OriginalFileName != "second.txt" {
+		t.Fatalf("expected first.txt and second.txt to be reported, but received %d files", len(files))
+	}
+
+	// The oversized file is not left on disk
+	if _, err := os.Stat(filepath.Join(uploadDir, "big.txt")); !os.IsNotExist(err) {
+		t.Error("expected big.txt to be removed")
+	}
+
+	if stored, _ := tools.CountFiles(uploadDir, ""); stored != 2 {
+		t.Errorf("expected 2 stored files, but received %d", stored)
+	}
+}
+
+// syntheticPE builds the start of a Windows PE executable, with the PE header at the offset
+func syntheticPE(offset int) []byte {
+	pe := make([]byte, offset+64)
+	copy(pe, "MZ\x90\x00")
+	binary.LittleEndian.PutUint32(pe[0x3C:], uint32(offset))
+	copy(pe[offset:], "PE\x00\x00")
+	return pe
+}
+
+func TestTools_UploadFiles_RejectExecutables(t *testing.T) {
+	tests := []struct {
+		name          string
+		fileName      string
+		content       []byte
+		expectedError string
+	}{
+		{"ELF binary", "photo.png", append([]byte("\x7fELF\x02\x01\x01"), make([]byte, 64)...), "ELF"},
+		{"Shell script", "notes.txt", []byte("#!/bin/sh\nrm -rf /\n"), "shebang script"},
+		{"PE binary", "setup.pdf", syntheticPE(0x80), "PE"},
+		{"PE header beyond the sniffed bytes", "setup.pdf", syntheticPE(0x400), "PE"},
+		{"Text starting with MZ", "MZ-1 report.txt", []byte("MZ-1 report\nThe quarterly numbers are in, see the attached tables for details.\n"), ""},
+		{"DOS header without PE signature", "old.bin", append([]byte("MZ\x90\x00"), make([]byte, 128)...), ""},
+		{"Mach-O binary", "tool", append([]byte{0xCF, 0xFA, 0xED, 0xFE}, make([]byte, 64)...), "Mach-O"},
+		{"Plain text", "notes.txt", []byte("just some notes\n"), ""},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{RejectExecutables: true}
+			req := newUploadRequest(t, testFile{"file", entry.fileName, entry.content})
+
+			_, err := tools.UploadFiles(req, t.TempDir())
+
+			if entry.expectedError == "" {
+				if err != nil {
+					t.Errorf("expected no error, but received %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), "("+entry.expectedError+")") {
+				t.Errorf("expected an error naming %s, but received %v", entry.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_ShortFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"Tiny text file", []byte("hello, world\n")},
+		{"Text file of 511 bytes", bytes.Repeat([]byte("a"), 511)},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{AllowedFileTypes: []string{"text/plain; charset=utf-8"}}
+			req := newUploadRequest(t, testFile{"file", "notes.txt", entry.content})
+
+			files, err := tools.UploadFiles(req, t.TempDir())
+			if err != nil {
+				t.Fatal("expected the text file to be accepted, but received", err)
+			}
+
+			if files[0].FileSize != int64(len(entry.content)) {
+				t.Errorf("expected %d bytes to be stored, but received %d", len(entry.content), files[0].FileSize)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_ValidateExtension(t *testing.T) {
+	png, err := os.ReadFile("./testdata/img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpeg := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, make([]byte, 64)...)
+
+	tests := []struct {
+		name          string
+		fileName      string
+		content       []byte
+		errorExpected bool
+	}{
+		{"Matching pair", "photo.png", png, false},
+		{"JPEG content with png extension", "photo.png", jpeg, true},
+		{"Unknown extension is let through", "photo.xyz", png, false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{ValidateExtension: true}
+			req := newUploadRequest(t, testFile{"file", entry.fileName, entry.content})
+
+			_, err := tools.UploadFiles(req, t.TempDir(), false)
+
+			if entry.errorExpected && (err == nil || !strings.Contains(err.Error(), "image/jpeg")) {
+				t.Errorf("expected an error naming the detected type, but received %v", err)
+			}
+
+			if !entry.errorExpected && err != nil {
+				t.Errorf("expected no error, but received %+v", err)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_ComputeChecksum(t *testing.T) {
+	png, err := os.ReadFile("./testdata/img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = "80728a5f476d2d62dbaa1da211e98ea7af78d7c2d536cb1ba520bec32b465b73"
+
+	tests := []struct {
+		name     string
+		tools    Tools
+		expected string
+	}{
+		{"Checksum computed", Tools{ComputeChecksum: true}, expected},
+		{"Checksum of the uncompressed content", Tools{ComputeChecksum: true, CompressOnDisk: true}, expected},
+		{"Checksum not requested", Tools{}, ""},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := newUploadRequest(t, testFile{"file", "img.png", png})
+
+			files, err := entry.tools.UploadFiles(req, t.TempDir())
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			if files[0].Checksum != entry.expected {
+				t.Errorf("expected checksum %q, but received %q", entry.expected, files[0].Checksum)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_OriginalFileNames(t *testing.T) {
+	tests := []struct {
+		name          string
+		fileName      string
+		expected      string
+		errorExpected bool
+	}{
+		{"Regular name", "notes.txt", "notes.txt", false},
+		{"Leading dots are kept", "..notes.txt", "..notes.txt", false},
+		{"Directories are stripped", "foo/bar.txt", "bar.txt", false},
+		{"Traversal with slashes", "../../etc/passwd", "passwd", false},
+		{"Traversal with backslashes", `..\..\evil.txt`, "", true},
+		{"Parent directory", "..", "", true},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			// Keep the upload directory inside another one to detect escaping files
+			parent := t.TempDir()
+			uploadDir := filepath.Join(parent, "uploads")
+
+			req := newUploadRequest(t, testFile{"file", entry.fileName, []byte("hello")})
+			files, err := tools.UploadFiles(req, uploadDir, false)
+
+			if entry.errorExpected {
+				if err == nil {
+					t.Errorf("expected an error, but received %s", files[0].NewFileName)
+				}
+			} else if err != nil {
+				t.Fatal("expected no error, but received", err)
+			} else if files[0].NewFileName != entry.expected {
+				t.Errorf("expected new file name %s, but received %s", entry.expected, files[0].NewFileName)
+			}
+
+			// Nothing is written next to the upload directory
+			if outside, _ := tools.CountFiles(parent, ""); outside != 0 {
+				t.Errorf("expected no files outside of the upload directory, but received %d", outside)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFilesFromField(t *testing.T) {
+	tests := []struct {
+		name      string
+		fieldName string
+		expected  []string
+	}{
+		{"Avatar field", "avatar", []string{"me.txt"}},
+		{"Document field", "document", []string{"cv.txt", "letter.txt"}},
+		{"Missing field", "other", nil},
+		{"All fields", "", []string{"cv.txt", "letter.txt", "me.txt"}},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var tools Tools
+			uploadDir := t.TempDir()
+			req := newUploadRequest(t,
+				testFile{"avatar", "me.txt", []byte("avatar")},
+				testFile{"document", "cv.txt", []byte("cv")},
+				testFile{"document", "letter.txt", []byte("letter")},
+			)
+
+			files, err := tools.UploadFilesFromField(req, entry.fieldName, uploadDir, false)
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			var names []string
+			for _, f := range files {
+				names = append(names, f.OriginalFileName)
+			}
+			sort.Strings(names)
+
+			if strings.Join(names, ",") != strings.Join(entry.expected, ",") {
+				t.Errorf("expected files %v, but received %v", entry.expected, names)
+			}
+
+			// Files of other fields are not written
+			if stored, _ := tools.CountFiles(uploadDir, ""); stored != len(entry.expected) {
+				t.Errorf("expected %d stored files, but received %d", len(entry.expected), stored)
+			}
+		})
+	}
+}
+
+// pngOfSize encodes a blank PNG image of the given dimensions
+func pngOfSize(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTools_UploadFiles_MaxImageDimensions(t *testing.T) {
+	tests := []struct {
+		name          string
+		width         int
+		height        int
+		expectedError string
+	}{
+		{"Within the limits", 200, 100, ""},
+		{"Too wide", 300, 10, "pixels wide"},
+		{"Too high", 10, 300, "pixels high"},
+		{"Too many pixels", 150, 150, "pixels, the maximum is"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{MaxImageWidth: 200, MaxImageHeight: 200, MaxImagePixels: 20000}
+			req := newUploadRequest(t, testFile{"file", "image.png", pngOfSize(t, entry.width, entry.height)})
+
+			_, err := tools.UploadFiles(req, t.TempDir())
+
+			if entry.expectedError == "" {
+				if err != nil {
+					t.Errorf("expected no error, but received %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), entry.expectedError) || !strings.Contains(err.Error(), "image.png") {
+				t.Errorf("expected an error about %q naming image.png, but received %v", entry.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_OverwriteBehavior(t *testing.T) {
+	tests := []struct {
+		name          string
+		behavior      OverwriteBehavior
+		expectedNames []string
+		errorExpected bool
+	}{
+		{"Overwrite", Overwrite, []string{"notes.txt", "notes.txt"}, false},
+		{"Error", OverwriteError, nil, true},
+		{"Rename", OverwriteRename, []string{"notes-2.txt", "notes-3.txt"}, false},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{OverwriteBehavior: entry.behavior}
+			uploadDir := t.TempDir()
+
+			// Existing files the upload collides with
+			for _, name := range []string{"notes.txt", "notes-1.txt"} {
+				if err := os.WriteFile(filepath.Join(uploadDir, name), []byte("old"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			req := newUploadRequest(t,
+				testFile{"file", "notes.txt", []byte("first")},
+				testFile{"file", "notes.txt", []byte("second")},
+			)
+			files, err := tools.UploadFiles(req, uploadDir, false)
+
+			if entry.errorExpected {
+				if err == nil || !strings.Contains(err.Error(), "already exists") {
+					t.Errorf("expected an already exists error, but received %v", err)
+				}
+			} else if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			var names []string
+			for _, f := range files {
+				names = append(names, f.NewFileName)
+			}
+			if strings.Join(names, ",") != strings.Join(entry.expectedNames, ",") {
+				t.Errorf("expected new file names %v, but received %v", entry.expectedNames, names)
+			}
+
+			// The existing file is only replaced in Overwrite mode
+			existing, _ := os.ReadFile(filepath.Join(uploadDir, "notes.txt"))
+			if replaced := string(existing) != "old"; replaced != (entry.behavior == Overwrite) {
+				t.Errorf("unexpected content of the existing file: %s", existing)
+			}
+		})
+	}
+}
+
+// failingWriter is a writer that always fails
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("connection lost")
+}
+
+func TestTools_UploadTee(t *testing.T) {
+	content := []byte("some text to store and forward at the same time")
+
+	tests := []struct {
+		name          string
+		field         string
+		allowedTypes  []string
+		maxFileSize   int
+		failing       bool
+		errorExpected string
+	}{
+		{"Both writers", "file", nil, 0, false, ""},
+		{"Missing field", "other", nil, 0, false, `no file uploaded in the form field "other"`},
+		{"Type not permitted", "file", []string{"image/png"}, 0, false, "the uploaded file type is not permitted"},
+		{"Too big", "file", nil, 10, false, "the uploaded file notes.txt is bigger than 10 bytes"},
+		{"Failing writer", "file", nil, 0, true, "writer 1 failed: connection lost"},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{AllowedFileTypes: entry.allowedTypes, MaxFileSize: entry.maxFileSize}
+			req := newUploadRequest(t, testFile{"file", "notes.txt", content})
+
+			var first, second bytes.Buffer
+			writers := []io.Writer{&first, &second}
+			if entry.failing {
+				writers[1] = failingWriter{}
+			}
+
+			file, err := tools.UploadTee(req, entry.field, writers...)
+			if entry.errorExpected != "" {
+				if err == nil || err.Error() != entry.errorExpected {
+					t.Fatalf("expected error %q, but received %v", entry.errorExpected, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			if !bytes.Equal(first.Bytes(), content) || !bytes.Equal(second.Bytes(), content) {
+				t.Errorf("expected both writers to receive %q, but received %q and %q", content, first.Bytes(), second.Bytes())
+			}
+			if file.OriginalFileName != "notes.txt" || file.FileSize != int64(len(content)) {
+				t.Errorf("expected notes.txt of %d bytes, but received %s of %d bytes", len(content), file.OriginalFileName, file.FileSize)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_EnforceIfMatch(t *testing.T) {
+	var tools Tools
+	current := []byte("current version")
+
+	tests := []struct {
+		name          string
+		enforce       bool
+		existing      bool
+		ifMatch       string
+		errorExpected bool
+	}{
+		{"Matching ETag", true, true, tools.ETag(current), false},
+		{"One of several ETags", true, true, `"other", ` + tools.ETag(current), false},
+		{"Any ETag", true, true, "*", false},
+		{"Stale ETag", true, true, tools.ETag([]byte("old version")), true},
+		{"Weak ETag", true, true, tools.WeakETag(current), true},
+		{"Missing file", true, false, tools.ETag(current), true},
+		{"No header", true, true, "", false},
+		{"Not enforced", false, true, tools.ETag([]byte("old version")), false},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{EnforceIfMatch: entry.enforce}
+			uploadDir := t.TempDir()
+			if entry.existing {
+				if err := os.WriteFile(filepath.Join(uploadDir, "doc.txt"), current, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			req := newUploadRequest(t, testFile{"file", "doc.txt", []byte("new version")})
+			if entry.ifMatch != "" {
+				req.Header.Set("If-Match", entry.ifMatch)
+			}
+
+			_, err := tools.UploadFiles(req, uploadDir, false)
+			if entry.errorExpected && !errors.Is(err, ErrPreconditionFailed) {
+				t.Fatalf("expected %v, but received %v", ErrPreconditionFailed, err)
+			}
+			if !entry.errorExpected && err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			// A rejected upload leaves the file as it was
+			expected := "new version"
+			if entry.errorExpected {
+				expected = string(current)
+			}
+			content, _ := os.ReadFile(filepath.Join(uploadDir, "doc.txt"))
+			if entry.existing && string(content) != expected {
+				t.Errorf("expected the file to contain %q, but received %q", expected, content)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_NormalizeTextUploads(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		content  []byte
+		style    LineEndingStyle
+		expected []byte
+	}{
+		{"CRLF to LF", "notes.txt", []byte("one\r\ntwo\r\n"), LineEndingLF, []byte("one\ntwo\n")},
+		{"LF to CRLF", "notes.txt", []byte("one\ntwo\n"), LineEndingCRLF, []byte("one\r\ntwo\r\n")},
+		{"Not enabled", "notes.txt", []byte("one\r\ntwo\n"), 0, []byte("one\r\ntwo\n")},
+		{"Binary untouched", "img.png", append(pngOfSize(t, 2, 2), '\r', '\n'), LineEndingLF, append(pngOfSize(t, 2, 2), '\r', '\n')},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{NormalizeTextUploads: entry.style}
+			uploadDir := t.TempDir()
+			req := newUploadRequest(t, testFile{"file", entry.fileName, entry.content})
+
+			files, err := tools.UploadFiles(req, uploadDir)
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			stored, err := os.ReadFile(filepath.Join(uploadDir, files[0].NewFileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(stored, entry.expected) {
+				t.Errorf("expected %q on disk, but received %q", entry.expected, stored)
+			}
+			if files[0].FileSize != int64(len(entry.expected)) {
+				t.Errorf("expected a size of %d, but received %d", len(entry.expected), files[0].FileSize)
+			}
+		})
+	}
+}
+
+// readCounter counts the bytes read from a request body
+type readCounter struct {
+	io.Reader
+	n int
+}
+
+func (rc *readCounter) Read(p []byte) (int, error) {
+	n, err := rc.Reader.Read(p)
+	rc.n += n
+	return n, err
+}
+
+func TestTools_UploadFiles_MaxUploadCount(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         int
+		fields        int
+		errorExpected bool
+	}{
+		{"Under the limit", 3, 1, false},
+		{"At the limit", 4, 1, false},
+		{"Fields count too", 3, 3, true},
+		{"Far over the limit", 50, 0, true},
+	}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{MaxUploadCount: 5}
+
+			// Write the multipart body by hand, the boundary must also be found across reads
+			var body strings.Builder
+			padding := strings.Repeat("x", 1000)
+			for i := 0; i < entry.fields; i++ {
+				fmt.Fprintf(&body, "--BOUNDARY\r\nContent-Disposition: form-data; name=\"field%d\"\r\n\r\n%s\r\n", i, padding)
+			}
+			for i := 0; i < entry.files; i++ {
+				fmt.Fprintf(&body, "--BOUNDARY\r\nContent-Disposition: form-data; name=\"file\"; filename=\"f%d.txt\"\r\nContent-Type: text/plain\r\n\r\n%s\r\n", i, padding)
+			}
+			body.WriteString("--BOUNDARY--\r\n")
+
+			counter := &readCounter{Reader: strings.NewReader(body.String())}
+			req := httptest.NewRequest(http.MethodPost, "/", counter)
+			req.Header.Set("Content-Type", "multipart/form-data; boundary=BOUNDARY")
+
+			files, err := tools.UploadFiles(req, t.TempDir())
+			if entry.errorExpected {
+				if err == nil || err.Error() != "too many parts in the multipart request" {
+					t.Fatalf("expected too many parts, but received %v", err)
+				}
+				var uploadErr *UploadError
+				if !errors.Is(err, ErrTooManyFiles) || !errors.As(err, &uploadErr) || uploadErr.Limit != 5 {
+					t.Errorf("expected an ErrTooManyFiles UploadError with limit 5, but received %#v", err)
+				}
+				// The rest of the body is never read
+				if entry.files > 10 && counter.n > body.Len()/2 {
+					t.Errorf("expected to stop early, but read %d of %d bytes", counter.n, body.Len())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+			if len(files) != entry.files {
+				t.Errorf("expected %d files, but received %d", entry.files, len(files))
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_UploadErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		tools         Tools
+		files         []testFile
+		bodyLimit     int64
+		expectedKind  error
+		expectedFile  string
+		expectedLimit int64
+	}{
+		{
+			name:          "File too big",
+			tools:         Tools{MaxFileSize: 10},
+			files:         []testFile{{"file", "big.txt", bytes.Repeat([]byte("a"), 11)}},
+			expectedKind:  ErrFileTooBig,
+			expectedFile:  "big.txt",
+			expectedLimit: 10,
+		},
+		{
+			name:         "Disallowed type",
+			tools:        Tools{AllowedFileTypes: []string{"image/png"}},
+			files:        []testFile{{"file", "notes.txt", []byte("notes")}},
+			expectedKind: ErrDisallowedType,
+			expectedFile: "notes.txt",
+		},
+		{
+			name:         "Extension mismatch",
+			tools:        Tools{ValidateExtension: true},
+			files:        []testFile{{"file", "photo.png", []byte("notes")}},
+			expectedKind: ErrDisallowedType,
+			expectedFile: "photo.png",
+		},
+		{
+			name:          "Too many files",
+			tools:         Tools{MaxFileCount: 1},
+			files:         []testFile{{"file", "first.txt", []byte("one")}, {"file", "second.txt", []byte("two")}},
+			expectedKind:  ErrTooManyFiles,
+			expectedLimit: 1,
+		},
+		{
+			name:          "Body over the server limit",
+			tools:         Tools{MaxFileSize: 1024},
+			files:         []testFile{{"file", "big.txt", bytes.Repeat([]byte("a"), 200)}},
+			bodyLimit:     100,
+			expectedKind:  ErrFileTooBig,
+			expectedLimit: 1024,
+		},
+		{
+			name:         "Executable",
+			tools:        Tools{RejectExecutables: true},
+			files:        []testFile{{"file", "run.txt", []byte("#!/bin/sh\necho hi\n")}},
+			expectedKind: ErrDisallowedType,
+			expectedFile: "run.txt",
+		},
+		{
+			name:          "Media too long",
+			tools:         Tools{MaxMediaDuration: time.Minute},
+			files:         []testFile{{"file", "long.mp4", syntheticMP4(2 * time.Minute)}},
+			expectedKind:  ErrFileTooBig,
+			expectedFile:  "long.mp4",
+			expectedLimit: int64(time.Minute),
+		},
+		{
+			name:          "Image too wide",
+			tools:         Tools{MaxImageWidth: 10},
+			files:         []testFile{{"file", "wide.png", pngOfSize(t, 20, 5)}},
+			expectedKind:  ErrFileTooBig,
+			expectedFile:  "wide.png",
+			expectedLimit: 10,
+		},
+		{
+			name:          "Gzip bomb",
+			tools:         Tools{ValidateGzip: true, MaxDecompressedSize: 1024},
+			files:         []testFile{{"file", "bomb.gz", gzipBytes(t, make([]byte, 64*1024))}},
+			expectedKind:  ErrFileTooBig,
+			expectedFile:  "bomb.gz",
+			expectedLimit: 1024,
+		},
+		{
+			name:         "Corrupt gzip",
+			tools:        Tools{ValidateGzip: true},
+			files:        []testFile{{"file", "corrupt.gz", gzipBytes(t, []byte("hello, world"))[:20]}},
+			expectedKind: ErrDisallowedType,
+			expectedFile: "corrupt.gz",
+		},
+	}
+
+	kinds := []error{ErrFileTooBig, ErrDisallowedType, ErrTooManyFiles}
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := newUploadRequest(t, entry.files...)
+			if entry.bodyLimit > 0 {
+				req.Body = http.MaxBytesReader(httptest.NewRecorder(), req.Body, entry.bodyLimit)
+			}
+
+			_, err := entry.tools.UploadFiles(req, t.TempDir(), false)
+
+			for _, kind := range kinds {
+				if errors.Is(err, kind) != (kind == entry.expectedKind) {
+					t.Errorf("expected errors.Is(err, %v) to be %t, but received %v", kind, kind == entry.expectedKind, err)
+				}
+			}
+
+			var uploadErr *UploadError
+			if !errors.As(err, &uploadErr) {
+				t.Fatalf("expected an *UploadError, but received %T", err)
+			}
+			if entry.expectedFile != "" && uploadErr.FileName != entry.expectedFile {
+				t.Errorf("expected the file name %q, but received %q", entry.expectedFile, uploadErr.FileName)
+			}
+			if uploadErr.Limit != entry.expectedLimit {
+				t.Errorf("expected the limit %d, but received %d", entry.expectedLimit, uploadErr.Limit)
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_MaxUploadBytesPerSec(t *testing.T) {
+	// Each upload fits in the burst of one second on its own,
+	// together they go 50000 bytes over it, which takes 0.5s at the shared rate
+	tools := Tools{MaxUploadBytesPerSec: 100000}
+	content := bytes.Repeat([]byte("a"), 75000)
+
+	reqs := []*http.Request{
+		newUploadRequest(t, testFile{"file", "first.txt", content}),
+		newUploadRequest(t, testFile{"file", "second.txt", content}),
+	}
+	uploadDir := t.TempDir()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(reqs))
+	start := time.Now()
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req *http.Request) {
+			defer wg.Done()
+			_, errs[i] = tools.UploadFiles(req, uploadDir)
+		}(i, req)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("expected upload %d to succeed, but received %v", i, err)
+		}
+	}
+	if elapsed < 400*time.Millisecond {
+		t.Errorf("expected the uploads to take about 500ms together, but they took %s", elapsed)
+	}
+	if elapsed > 3*time.Second {
+		t.Errorf("expected the uploads to take about 500ms together, but they took %s", elapsed)
+	}
+}
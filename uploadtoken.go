@@ -0,0 +1,153 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UploadTokenHeader is the header the upload methods read the token from when UploadTokenSecret is set
+const UploadTokenHeader = "X-Upload-Token"
+
+// Fields of an upload token that restrict the upload
+const (
+	// UploadTokenMaxSize limits the size of each file in bytes, on top of MaxFileSize
+	UploadTokenMaxSize = "maxSize"
+	// UploadTokenContentType lists the permitted file types, comma separated, on top of AllowedFileTypes
+	UploadTokenContentType = "contentType"
+)
+
+// errInvalidUploadToken is returned for tokens that are malformed or were tampered with
+var errInvalidUploadToken = errors.New("invalid upload token")
+
+// uploadTokenPayload is the signed content of an upload token
+type uploadTokenPayload struct {
+	Expires int64             `json:"exp"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// UploadToken() creates a signed token that authorizes an upload until expires, for clients that
+// upload directly without a session. The fields are bound to the token, UploadTokenMaxSize and
+// UploadTokenContentType restrict the upload. The token is base64url encoded JSON followed by an
+// HMAC-SHA256 signature made with secret
+func (t *Tools) UploadToken(fields map[string]string, expires time.Time, secret []byte) (string, error) {
+	if len(secret) == 0 {
+		return "", errors.New("a secret is required to sign upload tokens")
+	}
+
+	payload, err := json.Marshal(uploadTokenPayload{Expires: expires.Unix(), Fields: fields})
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + signUploadToken(encoded, secret), nil
+}
+
+// ValidateUploadToken() verifies the signature and the expiry of a token made by UploadToken
+// and returns the fields bound to it
+func (t *Tools) ValidateUploadToken(token string, secret []byte) (map[string]string, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("a secret is required to validate upload tokens")
+	}
+
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errInvalidUploadToken
+	}
+
+	// Compare in constant time to avoid leaking the expected signature
+	if !hmac.Equal([]byte(signature), []byte(signUploadToken(encoded, secret))) {
+		return nil, errInvalidUploadToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errInvalidUploadToken
+	}
+	var payload uploadTokenPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, errInvalidUploadToken
+	}
+
+	if time.Now().Unix() >= payload.Expires {
+		return nil, errors.New("the upload token has expired")
+	}
+
+	return payload.Fields, nil
+}
+
+// signUploadToken returns the base64url encoded HMAC-SHA256 of the encoded payload
+func signUploadToken(encoded string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// uploadLimits are the limits that apply to a single upload: MaxFileSize and AllowedFileTypes,
+// narrowed by the fields of the upload token when there is one
+type uploadLimits struct {
+	maxFileSize  int
+	allowedTypes []string
+}
+
+// authorizeUpload checks the upload token of the request when UploadTokenSecret is set.
+// Returns the limits of the upload, restricted by the fields of the token
+func (t *Tools) authorizeUpload(r *http.Request) (uploadLimits, error) {
+	limits := uploadLimits{maxFileSize: t.maxFileSize(), allowedTypes: t.AllowedFileTypes}
+	if len(t.UploadTokenSecret) == 0 {
+		return limits, nil
+	}
+
+	token := r.Header.Get(UploadTokenHeader)
+	if token == "" {
+		return limits, errors.New("missing upload token")
+	}
+	fields, err := t.ValidateUploadToken(token, t.UploadTokenSecret)
+	if err != nil {
+		return limits, err
+	}
+
+	if value, ok := fields[UploadTokenMaxSize]; ok {
+		maxSize, err := strconv.Atoi(value)
+		if err != nil || maxSize <= 0 {
+			return limits, fmt.Errorf("the upload token has an invalid %s", UploadTokenMaxSize)
+		}
+		if maxSize < limits.maxFileSize {
+			limits.maxFileSize = maxSize
+		}
+	}
+	if value, ok := fields[UploadTokenContentType]; ok {
+		var permitted []string
+		for _, fileType := range strings.Split(value, ",") {
+			fileType = strings.TrimSpace(fileType)
+			// The token can only narrow the types permitted by AllowedFileTypes
+			if len(t.AllowedFileTypes) == 0 || containsFold(t.AllowedFileTypes, fileType) {
+				permitted = append(permitted, fileType)
+			}
+		}
+		if len(permitted) == 0 {
+			return limits, errors.New("the upload token permits no file types")
+		}
+		limits.allowedTypes = permitted
+	}
+
+	return limits, nil
+}
+
+// containsFold reports whether the slice contains the value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
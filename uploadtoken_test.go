@@ -0,0 +1,124 @@
+package toolkit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_ValidateUploadToken(t *testing.T) {
+	var tools Tools
+	secret := []byte("upload secret")
+
+	valid, err := tools.UploadToken(map[string]string{"userID": "42"}, time.Now().Add(time.Minute), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := tools.UploadToken(nil, time.Now().Add(-time.Minute), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, signature, _ := strings.Cut(valid, ".")
+	otherPayload, _, _ := strings.Cut(expired, ".")
+
+	tests := []struct {
+		name          string
+		token         string
+		secret        []byte
+		errorExpected bool
+	}{
+		{"Valid token", valid, secret, false},
+		{"Expired token", expired, secret, true},
+		{"Wrong secret", valid, []byte("other secret"), true},
+		{"Swapped payload", otherPayload + "." + signature, secret, true},
+		{"Tampered signature", payload + "." + strings.Repeat("A", len(signature)), secret, true},
+		{"No signature", payload, secret, true},
+		{"Not base64", "!!!." + signature, secret, true},
+		{"Empty token", "", secret, true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			fields, err := tools.ValidateUploadToken(entry.token, entry.secret)
+
+			if entry.errorExpected {
+				if err == nil {
+					t.Error("expected an error, but received none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, but received %v", err)
+			}
+			if fields["userID"] != "42" {
+				t.Errorf("expected the userID field to be 42, but received %q", fields["userID"])
+			}
+		})
+	}
+}
+
+func TestTools_UploadFiles_UploadToken(t *testing.T) {
+	secret := []byte("upload secret")
+	var issuer Tools
+	newToken := func(fields map[string]string) string {
+		token, err := issuer.UploadToken(fields, time.Now().Add(time.Minute), secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name          string
+		token         string
+		content       []byte
+		expectedError string
+	}{
+		{"Missing token", "", []byte("notes"), "missing upload token"},
+		{"Invalid token", "not.valid", []byte("notes"), "invalid upload token"},
+		{"Valid token", newToken(nil), []byte("notes"), ""},
+		{"Within maxSize", newToken(map[string]string{UploadTokenMaxSize: "10"}), []byte("notes"), ""},
+		{"Over maxSize", newToken(map[string]string{UploadTokenMaxSize: "10"}), bytes.Repeat([]byte("a"), 11), "bigger than 10 bytes"},
+		{"Permitted contentType", newToken(map[string]string{UploadTokenContentType: "text/plain; charset=utf-8"}), []byte("notes"), ""},
+		{"Other contentType", newToken(map[string]string{UploadTokenContentType: "image/png"}), []byte("notes"), "not permitted"},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{UploadTokenSecret: secret}
+			req := newUploadRequest(t, testFile{"file", "notes.txt", entry.content})
+			if entry.token != "" {
+				req.Header.Set(UploadTokenHeader, entry.token)
+			}
+
+			files, err := tools.UploadFiles(req, t.TempDir())
+
+			if entry.expectedError == "" {
+				if err != nil {
+					t.Fatalf("expected no error, but received %v", err)
+				}
+				if len(files) != 1 {
+					t.Errorf("expected 1 uploaded file, but received %d", len(files))
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), entry.expectedError) {
+				t.Errorf("expected an error containing %q, but received %v", entry.expectedError, err)
+			}
+		})
+	}
+
+	// The token narrows the limits of the upload only, tools keeps its configuration
+	tools := Tools{UploadTokenSecret: secret}
+	req := newUploadRequest(t, testFile{"file", "notes.txt", []byte("notes")})
+	req.Header.Set(UploadTokenHeader, newToken(map[string]string{UploadTokenMaxSize: "10"}))
+	if _, err := tools.UploadFiles(req, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if tools.MaxFileSize != 0 {
+		t.Errorf("expected MaxFileSize to stay 0, but received %d", tools.MaxFileSize)
+	}
+}
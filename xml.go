@@ -0,0 +1,79 @@
+package toolkit
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// WriteXML writes the data as an XML document with the provided status, the XML counterpart of WriteJSON.
+// Optional headers are applied the same way as in WriteJSON
+func (t *Tools) WriteXML(w http.ResponseWriter, status int, data interface{}, headers ...http.Header) error {
+	// Attempt to marshal the data into an indented XML format
+	xmlData, err := xml.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Start the document with the XML declaration
+	xmlData = append([]byte(xml.Header), xmlData...)
+
+	// Check if a custom header should be set
+	if len(headers) > 0 {
+		for indx, hdr := range headers[0] {
+			w.Header()[indx] = hdr
+		}
+	}
+
+	// Set Content-Type, Content-Length and provided status
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(xmlData)))
+	w.WriteHeader(status)
+
+	_, err = w.Write(xmlData)
+	return err
+}
+
+// ReadXML reads and decodes an XML request body into data, the XML counterpart of ReadJSON.
+// The body is limited to MaxXMLSize, 1MB by default, and decoding errors are reported in plain words
+func (t *Tools) ReadXML(w http.ResponseWriter, r *http.Request, data interface{}) error {
+	// Check if the payload is of permitted size
+	maxBytes := 1024 * 1024 // 1 Mg
+	if t.MaxXMLSize != 0 {
+		maxBytes = t.MaxXMLSize
+	}
+
+	// Read request of the body
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	err := xml.NewDecoder(r.Body).Decode(data)
+	if err != nil {
+		var syntaxError *xml.SyntaxError
+		var maxBytesError *http.MaxBytesError
+		var numError *strconv.NumError
+		switch {
+		case errors.As(err, &maxBytesError):
+			// If the body exceeds the allowed size, return an error with the size limit
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		case errors.Is(err, io.EOF):
+			// If the body is empty, return an error indicating that the body must not be empty
+			return errors.New("body must not be empty")
+		case errors.As(err, &syntaxError):
+			// If there's a syntax error in the XML, report the line of the error
+			return fmt.Errorf("body contains badly-formed XML (at line %d)", syntaxError.Line)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			// If the body is incomplete, return a malformed XML error
+			return errors.New("body contains badly-formed XML")
+		case errors.As(err, &numError):
+			// If a number does not parse, report the value
+			return fmt.Errorf("body contains incorrect XML value %q", numError.Num)
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package toolkit
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type xmlBook struct {
+	XMLName xml.Name `xml:"book"`
+	Title   string   `xml:"title"`
+	Year    int      `xml:"year,attr"`
+}
+
+func TestTools_WriteXML(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		data          interface{}
+		hdr           string
+		value         string
+		errorExpected bool
+	}{
+		{"Valid document", http.StatusOK, xmlBook{Title: "Go", Year: 2015}, "FOO", "BAR", false},
+		{"Custom status", http.StatusCreated, xmlBook{Title: "Go"}, "HELLO", "WORLD", false},
+		{"Unsupported value", http.StatusOK, map[string]string{"a": "b"}, "", "", true},
+	}
+
+	var tools Tools
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			headers := make(http.Header)
+			if entry.hdr != "" {
+				headers.Add(entry.hdr, entry.value)
+			}
+
+			err := tools.WriteXML(resp, entry.status, entry.data, headers)
+
+			if entry.errorExpected {
+				if err == nil {
+					t.Error("expected an error, but received none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, but received", err)
+			}
+
+			if resp.Code != entry.status {
+				t.Errorf("expected status code %d, but received %d", entry.status, resp.Code)
+			}
+
+			if resp.Header().Get("Content-Type") != "application/xml" {
+				t.Errorf("expected Content-Type application/xml, but received %s", resp.Header().Get("Content-Type"))
+			}
+
+			if resp.Header().Get(entry.hdr) != entry.value {
+				t.Errorf("expected to receive header %s, but received %s", entry.hdr, resp.Header().Get(entry.hdr))
+			}
+
+			var decoded xmlBook
+			if err := xml.Unmarshal(resp.Body.Bytes(), &decoded); err != nil {
+				t.Fatal("expected valid XML, but received", err)
+			}
+			if expected := entry.data.(xmlBook); decoded.Title != expected.Title || decoded.Year != expected.Year {
+				t.Errorf("expected %+v, but received %+v", entry.data, decoded)
+			}
+		})
+	}
+}
+
+func TestTools_ReadXML(t *testing.T) {
+	tests := []struct {
+		name          string
+		xml           string
+		maxSize       int
+		expectedError string
+	}{
+		{"Valid XML", `<book year="2015"><title>Go</title></book>`, 0, ""},
+		{"Valid XML with declaration", `<?xml version="1.0"?><book><title>Go</title></book>`, 0, ""},
+		{"Malformed XML", `<book><title>Go</book>`, 0, "body contains badly-formed XML (at line 1)"},
+		{"Incorrect value", `<book year="soon"><title>Go</title></book>`, 0, `body contains incorrect XML value "soon"`},
+		{"Empty body", "", 0, "body must not be empty"},
+		{"Too large body", `<book><title>` + strings.Repeat("a", 100) + `</title></book>`, 50, "body must not be larger than 50 bytes"},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			tools := Tools{MaxXMLSize: entry.maxSize}
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(entry.xml))
+			resp := httptest.NewRecorder()
+
+			var book xmlBook
+			err := tools.ReadXML(resp, req, &book)
+
+			if entry.expectedError == "" {
+				if err != nil {
+					t.Errorf("expected no error, but received %v", err)
+				}
+				if book.Title != "Go" {
+					t.Errorf("expected title Go, but received %s", book.Title)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != entry.expectedError {
+				t.Errorf("expected error %q, but received %v", entry.expectedError, err)
+			}
+		})
+	}
+}